@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Name of the file (relative to the "generate" directory) recording the
+// digests base images have been pinned to
+const baseImageLockFile = "base-images.lock.json"
+
+// BaseImageLock records the digests base image tags resolved to, keyed by
+// image (eg. ubuntu:24.04)
+type BaseImageLock struct {
+	*lockFile[ImageDigests]
+}
+
+// ImageDigests are the digests a base image tag resolved to
+type ImageDigests struct {
+	// Digest of the tag itself: the image index of a multi-platform
+	// image, or the manifest of a single-platform one
+	Index string `json:"index"`
+	// Digest of the manifest of each platform, for multi-platform images
+	Platforms map[Arch]string `json:"platforms,omitempty"`
+}
+
+// loadBaseImageLock reads generate/base-images.lock.json under the given
+// base directory. A missing file results in an empty lock.
+func loadBaseImageLock(baseDir string) (*BaseImageLock, error) {
+	lock, err := loadLockFile[ImageDigests](baseDir, baseImageLockFile, "images")
+	if err != nil {
+		return nil, err
+	}
+	return &BaseImageLock{lock}, nil
+}
+
+func (lock *BaseImageLock) Get(image string) (ImageDigests, bool) {
+	return lock.get(image)
+}
+
+func (lock *BaseImageLock) Set(image string, digests ImageDigests) {
+	lock.set(image, digests)
+}
+
+// pinBaseImage returns the image pinned to the digest recorded in the
+// base image lockfile, resolving and recording it first if necessary
+func (variant DockerfileVariant) pinBaseImage(image string) (string, error) {
+	if strings.Contains(image, "@") {
+		// Already pinned, eg. by a version customization
+		return image, nil
+	}
+
+	if variant.deferRemote {
+		return image + "@@@DIGEST@@", nil
+	}
+
+	gen := variant.gen
+	digests, ok := gen.BaseImageLock.Get(image)
+	if !ok {
+		if gen.Offline {
+			return "", fmt.Errorf("no digest for base image %s in %s, and running offline", image, baseImageLockFile)
+		}
+		variant.log.Printf("Resolving digest of base image %s", image)
+		resolved, err := gen.resolveImage(image)
+		if err != nil {
+			return "", err
+		}
+		gen.BaseImageLock.Set(image, resolved)
+		digests = resolved
+	}
+
+	digest, err := digests.forArches(variant.Arches)
+	if err != nil {
+		return "", fmt.Errorf("base image %s: %v", image, err)
+	}
+	return image + "@" + digest, nil
+}
+
+// baseImageRecord returns the base image of the variant along with the
+// digest it is built from, to be recorded in the directory's metadata:
+// the digest it is pinned to, or if it isn't pinned, the digest the tag
+// currently resolves to. As an unpinned Dockerfile doesn't depend on the
+// digest, nil is returned if it can't be resolved, and for images pinned
+// by a version customization.
+func (variant DockerfileVariant) baseImageRecord() (*baseImageRecord, error) {
+	image, err := variant.unpinnedBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(image, "@") {
+		return nil, nil
+	}
+
+	if variant.PinDigests {
+		pinned, err := variant.pinBaseImage(image)
+		if err != nil {
+			return nil, err
+		}
+		_, digest, _ := strings.Cut(pinned, "@")
+		return &baseImageRecord{Image: image, Digest: digest}, nil
+	}
+
+	gen := variant.gen
+	if gen.Offline {
+		variant.log.Printf("Not recording digest of base image %s, running offline", image)
+		return nil, nil
+	}
+	digests, err := gen.resolveImage(image)
+	if err == nil {
+		var digest string
+		if digest, err = digests.forArches(variant.Arches); err == nil {
+			return &baseImageRecord{Image: image, Digest: digest}, nil
+		}
+	}
+	variant.log.Printf("Not recording digest of base image %s: %v", image, err)
+	return nil, nil
+}
+
+// forArches returns the digest to pin an image built for the given
+// arches to: the digest of the platform's manifest for a single arch, or
+// the index digest if there are several, so that each arch still gets its
+// own platform
+func (digests ImageDigests) forArches(arches []Arch) (string, error) {
+	if len(arches) != 1 || len(digests.Platforms) == 0 {
+		return digests.Index, nil
+	}
+	digest, ok := digests.Platforms[arches[0]]
+	if !ok {
+		return "", fmt.Errorf("no manifest for linux/%s", arches[0])
+	}
+	return digest, nil
+}
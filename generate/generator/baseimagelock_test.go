@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestImageDigestsForArches(t *testing.T) {
+	index := ImageDigests{
+		Index:     "sha256:index",
+		Platforms: map[Arch]string{Archamd64: "sha256:amd64", Archarm64: "sha256:arm64"},
+	}
+	amd64Only := ImageDigests{
+		Index:     "sha256:index",
+		Platforms: map[Arch]string{Archamd64: "sha256:amd64"},
+	}
+	single := ImageDigests{Index: "sha256:manifest"}
+
+	tests := []struct {
+		name    string
+		digests ImageDigests
+		arches  []Arch
+		want    string
+		wantErr bool
+	}{
+		{name: "index, one arch", digests: index, arches: []Arch{Archarm64}, want: "sha256:arm64"},
+		{name: "index, several arches", digests: index, arches: []Arch{Archamd64, Archarm64}, want: "sha256:index"},
+		{name: "index, unknown arch", digests: amd64Only, arches: []Arch{Archarm64}, wantErr: true},
+		{name: "single manifest", digests: single, arches: []Arch{Archamd64}, want: "sha256:manifest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.digests.forArches(test.arches)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBaseImageLockSave(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.Mkdir(path.Join(baseDir, "generate"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := loadBaseImageLock(baseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := ImageDigests{Index: "sha256:index", Platforms: map[Arch]string{Archamd64: "sha256:amd64"}}
+	lock.Set("ubuntu:24.04", digests)
+	if err := lock.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path.Join(baseDir, "generate", baseImageLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+    "images": {
+        "ubuntu:24.04": {
+            "index": "sha256:index",
+            "platforms": {
+                "amd64": "sha256:amd64"
+            }
+        }
+    }
+}
+`
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+
+	if lock, err = loadBaseImageLock(baseDir); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := lock.Get("ubuntu:24.04"); !ok || !reflect.DeepEqual(got, digests) {
+		t.Errorf("reloaded %+v, %t", got, ok)
+	}
+	entries, _ := os.ReadDir(path.Join(baseDir, "generate"))
+	if len(entries) != 1 {
+		t.Errorf("expected only the lockfile, found %d files", len(entries))
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// runCheck renders every variant in the repository in memory and compares
+// the result with what is committed, printing a unified diff for every
+// file that has drifted from the templates and resources. It returns the
+// result for every variant, and the total number of drifted files.
+func (gen *Generator) runCheck(filter variantFilter) ([]*variantResult, int, error) {
+	matching, err := gen.matchingVariants(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	variants := []DockerfileVariant{}
+	for _, variant := range matching {
+		if !skipGeneration.Matches(variant.Product, variant.versionDirName()) {
+			variants = append(variants, variant)
+		}
+	}
+
+	results := gen.forEachVariant(variants, func(variant DockerfileVariant) error {
+		variant, err := variant.withSavedSettings()
+		if err != nil {
+			return err
+		}
+		return checkVariant(variant)
+	})
+
+	drifted := 0
+	for _, result := range results {
+		drifted += result.Drifted
+	}
+	return results, drifted, nil
+}
+
+// checkVariant prints a diff for every file of the variant which differs
+// from what is on disk
+func checkVariant(variant DockerfileVariant) error {
+	files, err := renderVariant(variant)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		diff, err := diffRenderedFile(variant.targetDir(), file)
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			fmt.Fprint(&variant.result.stdout, diff)
+			variant.result.Drifted++
+		}
+	}
+
+	// Leftovers in the mirrored subdirectories have drifted too
+	extra, err := extraMirroredFiles(variant, files)
+	if err != nil {
+		return err
+	}
+	for _, file := range extra {
+		diff, err := diffDeletedFile(path.Join(variant.targetDir(), file))
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(&variant.result.stdout, diff)
+		variant.result.Drifted++
+	}
+
+	if variant.result.Drifted > 0 {
+		variant.result.Detail = fmt.Sprintf("%d file(s) drifted", variant.result.Drifted)
+	}
+	return nil
+}
+
+// diffRenderedFile returns a unified diff between the file currently in
+// targetDir and the rendered file, or "" if they're identical
+func diffRenderedFile(targetDir string, file renderedFile) (string, error) {
+	filename := path.Join(targetDir, file.Path)
+
+	existing, err := os.ReadFile(filename)
+	fromFile := filename
+	if os.IsNotExist(err) {
+		existing = nil
+		fromFile = "/dev/null"
+	} else if err != nil {
+		return "", err
+	}
+
+	if existing != nil && bytes.Equal(existing, file.Content) {
+		// Only the executable bit is meaningful to git
+		info, err := os.Stat(filename)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&0111 != file.Mode&0111 {
+			return fmt.Sprintf("--- %s\n+++ %s\nmode changed %v => %v\n",
+				filename, filename, info.Mode().Perm(), file.Mode), nil
+		}
+		return "", nil
+	}
+
+	if isBinary(existing) || isBinary(file.Content) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", fromFile, filename), nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existing)),
+		B:        difflib.SplitLines(string(file.Content)),
+		FromFile: fromFile,
+		ToFile:   filename,
+		Context:  3,
+	})
+}
+
+// diffDeletedFile returns a unified diff removing the whole of filename
+func diffDeletedFile(filename string) (string, error) {
+	existing, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if isBinary(existing) {
+		return fmt.Sprintf("Binary files %s and /dev/null differ\n", filename), nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existing)),
+		FromFile: filename,
+		ToFile:   "/dev/null",
+		Context:  3,
+	})
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "fmt"
+
+// Name of the file (relative to the "generate" directory) recording the
+// SHA256 digest of every package that has been generated for
+const checksumLockFile = "checksums.lock.json"
+
+// ChecksumLock records the SHA256 of packages, keyed by
+// $product/$edition/$version/$arch (eg. couchbase-server/enterprise/7.6.2/amd64)
+type ChecksumLock struct {
+	*lockFile[string]
+}
+
+// loadChecksumLock reads generate/checksums.lock.json under the given base
+// directory. A missing file results in an empty lock.
+func loadChecksumLock(baseDir string) (*ChecksumLock, error) {
+	lock, err := loadLockFile[string](baseDir, checksumLockFile, "checksums")
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumLock{lock}, nil
+}
+
+func (lock *ChecksumLock) Get(variant DockerfileVariant, arch Arch) (string, bool) {
+	return lock.get(checksumLockKey(variant, arch))
+}
+
+func (lock *ChecksumLock) Set(variant DockerfileVariant, arch Arch, sha256 string) {
+	lock.set(checksumLockKey(variant, arch), sha256)
+}
+
+// checksumLockKey uses the real package version, with a -staging suffix
+// so that staging packages are recorded separately from released ones
+func checksumLockKey(variant DockerfileVariant, arch Arch) string {
+	version := variant.Version
+	if variant.IsStaging {
+		version = fmt.Sprintf("%s-staging", version)
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", variant.Product, variant.Edition, version, arch)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ChecksumError is returned when the SHA256 digest of a package can't be
+// retrieved. Rather than rendering a broken digest into the Dockerfile
+// (which would only fail at docker build time), generation is aborted.
+type ChecksumError struct {
+	URL string
+	// HTTP status code of the response, or 0 if there was no response
+	StatusCode int
+	Err        error
+}
+
+func (e *ChecksumError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("failed to get SHA256 from %s: HTTP status %d", e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("failed to get SHA256 from %s: %v", e.URL, e.Err)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	return e.Err
+}
+
+// errNotLocked is the cause of a ChecksumError when running --offline and
+// the checksum lockfile has no entry for a package
+var errNotLocked = errors.New("not in " + checksumLockFile + " and running offline")
+
+// sha256Params returns the CB_SHA256_<arch> template parameters for
+// every arch, along with CB_SKIP_CHECKSUM. The digest is left empty for
+// any arch the variant isn't built for, or for all arches if checksums
+// are being skipped.
+func (variant DockerfileVariant) sha256Params() (map[string]any, error) {
+	params := map[string]any{
+		"CB_SKIP_CHECKSUM": fmt.Sprintf("%t", variant.SkipChecksum),
+	}
+	for _, arch := range []Arch{Archamd64, Archarm64} {
+		params[fmt.Sprintf("CB_SHA256_%s", arch)] = ""
+	}
+	if variant.SkipChecksum {
+		variant.log.Printf("Skipping SHA256 verification")
+		return params, nil
+	}
+
+	for _, arch := range variant.Arches {
+		sha256, err := variant.getSHA256(arch)
+		if err != nil {
+			return nil, err
+		}
+		params[fmt.Sprintf("CB_SHA256_%s", arch)] = sha256
+	}
+	return params, nil
+}
+
+func (variant DockerfileVariant) getSHA256(arch Arch) (string, error) {
+	if customization, ok := variant.versionCustomization(); ok {
+		if sha256, ok := customization.SHA256[arch]; ok {
+			return sha256, nil
+		}
+	}
+
+	packageURL, err := variant.packageURL(arch)
+	if err != nil {
+		return "", err
+	}
+	sha256url := packageURL + ".sha256"
+	if variant.deferRemote {
+		return "@@SHA256 of " + sha256url + "@@", nil
+	}
+
+	if sha256, ok := variant.gen.ChecksumLock.Get(variant, arch); ok {
+		return sha256, nil
+	}
+	if variant.gen.Offline {
+		return "", &ChecksumError{URL: sha256url, Err: errNotLocked}
+	}
+
+	sha256, err := variant.downloadSHA256(sha256url)
+	if err != nil {
+		return "", err
+	}
+	variant.gen.ChecksumLock.Set(variant, arch, sha256)
+	return sha256, nil
+}
+
+func (variant DockerfileVariant) downloadSHA256(sha256url string) (string, error) {
+	variant.log.Print(sha256url)
+
+	resp, err := http.Get(sha256url)
+	if err != nil {
+		return "", &ChecksumError{URL: sha256url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &ChecksumError{URL: sha256url, StatusCode: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &ChecksumError{URL: sha256url, Err: err}
+	}
+
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", &ChecksumError{URL: sha256url, Err: fmt.Errorf("empty SHA256 file")}
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Name of the file (relative to the "generate" directory) holding the
+// settings of the generator itself, used unless --config names another
+const configFile = "generator.json"
+
+// Config holds settings of the generator which depend on where it runs,
+// rather than on the products being generated
+type Config struct {
+	// Where builds which haven't been released (eg. 8.1.0-1234) are
+	// downloaded from
+	BuildServer BuildServer `json:"build_server"`
+	// Rewrites of package download URLs, for building from an internal
+	// mirror: every URL starting with a key starts with its value
+	// instead, eg. {"https://packages.couchbase.com/":
+	// "https://mirror.example.com/couchbase/"}. The longest matching key
+	// wins.
+	PackageMirrors map[string]string `json:"package_mirrors"`
+	// Replacements of the registries base images are pulled from, eg.
+	// {"docker.io": "mirror.example.com/dockerhub"}. Images which don't
+	// name a registry, such as ubuntu:24.04, are from docker.io.
+	RegistryMirrors map[string]string `json:"registry_mirrors"`
+	// Base URLs of the Docker Registry HTTP API of each registry, where
+	// they aren't https://REGISTRY (or https://registry-1.docker.io for
+	// docker.io), eg. {"docker.io": "http://localhost:5000"} to resolve
+	// base image digests against a local registry
+	RegistryURLs map[string]string `json:"registry_urls"`
+	// Hosts packages may be downloaded from over plain http. Download
+	// URLs are otherwise required to use https.
+	AllowHTTPHosts []string `json:"allow_http_hosts"`
+}
+
+// BuildServer describes the layout of an internal build server, so that
+// images can be generated for any build by giving a version with a build
+// number, eg. 8.1.0-1234.
+//
+// URLs and filenames may contain the placeholders @@PRODUCT@@,
+// @@EDITION@@, @@VERSION@@ (eg. 8.1.0-1234), @@RELEASE@@ (eg. 8.1.0),
+// @@BUILD@@ (eg. 1234) and @@RELEASE_NAME@@; filenames may also contain
+// @@ARCH@@.
+type BuildServer struct {
+	// URL of the directory holding the packages of a build. Builds are
+	// only taken from the build server if this is set.
+	URL string `json:"url"`
+	// A version constraint limiting which releases are taken from the
+	// build server, eg. ">= 8.0". This is checked against the version
+	// without the build number. Builds of other releases, and all
+	// versions without a build number, are downloaded as usual.
+	Versions string `json:"versions"`
+	// Package filename per product, where it differs from the usual one
+	PackageFiles map[Product]string `json:"package_files"`
+	// Name of each release, by version prefix, for @@RELEASE_NAME@@, eg.
+	// {"7.6": "trinity"}. The longest matching prefix wins.
+	ReleaseNames map[string]string `json:"release_names"`
+
+	constraints Constraints
+}
+
+// loadConfig reads the generator settings from the given file, or from
+// generate/generator.json under the base directory if filename is empty.
+// A missing default file is not an error; it simply means the defaults
+// apply.
+func loadConfig(baseDir string, filename string) (*Config, error) {
+	optional := filename == ""
+	if optional {
+		filename = path.Join(baseDir, "generate", configFile)
+	}
+
+	config := &Config{}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) && optional {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := newStrictDecoder(data).Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return config, nil
+}
+
+// validate checks the settings, reporting all problems at once
+func (config *Config) validate() error {
+	problems := []string{}
+
+	buildServer := &config.BuildServer
+	if buildServer.Versions != "" {
+		constraints, err := parseConstraints(buildServer.Versions)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("bad versions '%s' in build_server: %v", buildServer.Versions, err))
+		}
+		buildServer.constraints = constraints
+	}
+	for product := range buildServer.PackageFiles {
+		if !isKnownProduct(product) {
+			problems = append(problems, fmt.Sprintf("unknown product '%s' in package_files of build_server", product))
+		}
+	}
+	for prefix := range buildServer.ReleaseNames {
+		if _, err := parseVersion(prefix); err != nil {
+			problems = append(problems, fmt.Sprintf("bad version '%s' in release_names of build_server", prefix))
+		}
+	}
+
+	for from, to := range config.PackageMirrors {
+		if from == "" || to == "" {
+			problems = append(problems, fmt.Sprintf("empty URL in package_mirrors entry '%s': '%s'", from, to))
+		}
+	}
+	for registry, u := range config.RegistryURLs {
+		if registry == "" || u == "" {
+			problems = append(problems, fmt.Sprintf("empty registry or URL in registry_urls entry '%s': '%s'", registry, u))
+		}
+	}
+	for from, to := range config.RegistryMirrors {
+		if from == "" || to == "" {
+			problems = append(problems, fmt.Sprintf("empty registry in registry_mirrors entry '%s': '%s'", from, to))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// addMappings adds KEY=VALUE arguments given on the command line, such as
+// package or registry mirrors, to the corresponding setting, replacing any
+// entry with the same KEY
+func addMappings(mappings *map[string]string, args []string) error {
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" || value == "" {
+			return fmt.Errorf("'%s' not of form KEY=VALUE", arg)
+		}
+		if *mappings == nil {
+			*mappings = map[string]string{}
+		}
+		(*mappings)[key] = value
+	}
+	return nil
+}
+
+// mirrorURL rewrites a package download URL according to the package
+// mirrors
+func (config *Config) mirrorURL(url string) string {
+	longest := ""
+	for from := range config.PackageMirrors {
+		if strings.HasPrefix(url, from) && len(from) > len(longest) {
+			longest = from
+		}
+	}
+	if longest == "" {
+		return url
+	}
+	return config.PackageMirrors[longest] + strings.TrimPrefix(url, longest)
+}
+
+// mirrorImage rewrites the registry of a base image according to the
+// registry mirrors, eg. ubuntu:24.04 becomes
+// mirror.example.com/dockerhub/library/ubuntu:24.04 for
+// {"docker.io": "mirror.example.com/dockerhub"}
+func (config *Config) mirrorImage(image string) string {
+	if len(config.RegistryMirrors) == 0 {
+		return image
+	}
+
+	registry, name := splitImageRegistry(image)
+	mirror, ok := config.RegistryMirrors[registry]
+	if !ok {
+		return image
+	}
+	if registry == "docker.io" && !strings.Contains(name, "/") {
+		// Official images, such as ubuntu, live under library/
+		name = "library/" + name
+	}
+	return mirror + "/" + name
+}
+
+// splitImageRegistry splits an image into its registry and the rest of
+// its name. As with docker, the first component of the name is a
+// registry only if it looks like a hostname; otherwise the image is from
+// docker.io.
+func splitImageRegistry(image string) (string, string) {
+	if first, rest, ok := strings.Cut(image, "/"); ok &&
+		(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+	return "docker.io", image
+}
+
+// build returns the version and build number of the variant, if it is a
+// build which is downloaded from the build server
+func (buildServer BuildServer) build(variant DockerfileVariant) (Version, bool, error) {
+	if buildServer.URL == "" {
+		return Version{}, false, nil
+	}
+	v, err := parseVersion(variant.Version)
+	if err != nil {
+		return Version{}, false, err
+	}
+	if _, ok := v.Build(); !ok {
+		return v, false, nil
+	}
+	if buildServer.constraints != nil && !buildServer.constraints.Check(v.Core()) {
+		return v, false, nil
+	}
+	return v, true, nil
+}
+
+// releaseURL returns the URL of the directory holding the packages of the
+// build
+func (buildServer BuildServer) releaseURL(variant DockerfileVariant, v Version) (string, error) {
+	return buildServer.expand(buildServer.URL, variant, v)
+}
+
+// packageFile returns the configured package filename of the build for the
+// given arch, if any
+func (buildServer BuildServer) packageFile(variant DockerfileVariant, v Version, arch Arch) (string, bool, error) {
+	filename, ok := buildServer.PackageFiles[variant.Product]
+	if !ok {
+		return "", false, nil
+	}
+	if arch != Archgeneric {
+		filename = strings.ReplaceAll(filename, string(Archgeneric), string(arch))
+	}
+	filename, err := buildServer.expand(filename, variant, v)
+	return filename, true, err
+}
+
+// expand replaces the placeholders in s
+func (buildServer BuildServer) expand(s string, variant DockerfileVariant, v Version) (string, error) {
+	build, _ := v.Build()
+	replacements := []string{
+		"@@PRODUCT@@", string(variant.Product),
+		"@@EDITION@@", string(variant.Edition),
+		"@@VERSION@@", v.String(),
+		"@@RELEASE@@", v.Core().String(),
+		"@@BUILD@@", fmt.Sprintf("%d", build),
+	}
+	if strings.Contains(s, "@@RELEASE_NAME@@") {
+		name, ok := buildServer.releaseName(v)
+		if !ok {
+			return "", fmt.Errorf("no release name configured for %s in build_server", v.Core())
+		}
+		replacements = append(replacements, "@@RELEASE_NAME@@", name)
+	}
+	return strings.NewReplacer(replacements...).Replace(s), nil
+}
+
+// releaseName returns the name of the release of the given version, from
+// the longest matching prefix in ReleaseNames
+func (buildServer BuildServer) releaseName(v Version) (string, bool) {
+	core := v.Core().String()
+	name, longest := "", -1
+	for prefix, n := range buildServer.ReleaseNames {
+		if (core == prefix || strings.HasPrefix(core, prefix+".")) && len(prefix) > longest {
+			name, longest = n, len(prefix)
+		}
+	}
+	return name, longest >= 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import "testing"
+
+func TestBuildServer(t *testing.T) {
+	config := &Config{
+		BuildServer: BuildServer{
+			URL:      "https://builds.example.com/@@RELEASE_NAME@@/@@BUILD@@",
+			Versions: ">= 8.0",
+			PackageFiles: map[Product]string{
+				ProductServer: "couchbase-server-@@EDITION@@_@@VERSION@@-linux_@@ARCH@@.deb",
+			},
+			ReleaseNames: map[string]string{"8": "morpheus", "8.1": "totoro", "9.0": "cypher"},
+		},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version    string
+		arch       Arch
+		releaseURL string
+		file       string
+		wantErr    bool
+	}{
+		{
+			version:    "8.1.0-1234",
+			arch:       Archarm64,
+			releaseURL: "https://builds.example.com/totoro/1234",
+			file:       "couchbase-server-enterprise_8.1.0-1234-linux_arm64.deb",
+		},
+		{
+			version:    "8.0.1-55",
+			arch:       Archgeneric,
+			releaseURL: "https://builds.example.com/morpheus/55",
+			file:       "couchbase-server-enterprise_8.0.1-55-linux_@@ARCH@@.deb",
+		},
+		// Releases outside the versions of the build server, and versions
+		// without a build number, are downloaded as usual
+		{
+			version:    "7.6.2-100",
+			arch:       Archamd64,
+			releaseURL: "https://packages.couchbase.com/releases/7.6.2-100",
+			file:       "couchbase-server-enterprise_7.6.2-100-linux_amd64.deb",
+		},
+		{
+			version:    "8.1.0",
+			arch:       Archamd64,
+			releaseURL: "https://packages.couchbase.com/releases/8.1.0",
+			file:       "couchbase-server-enterprise_8.1.0-linux_amd64.deb",
+		},
+		// There's no name for 10.0.0
+		{version: "10.0.0-1", arch: Archamd64, wantErr: true},
+	}
+
+	for _, test := range tests {
+		variant := testVariant(ProductServer, EditionEnterprise, test.version, Archamd64, Archarm64)
+		variant.gen.Config = config
+		releaseURL, err := variant.uncheckedReleaseURL()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", test.version, releaseURL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.version, err)
+			continue
+		}
+		file, err := variant.packageFile(test.arch)
+		if err != nil {
+			t.Errorf("%s: %v", test.version, err)
+			continue
+		}
+		if releaseURL != test.releaseURL || file != test.file {
+			t.Errorf("%s %s: got %s/%s, want %s/%s", test.version, test.arch, releaseURL, file, test.releaseURL, test.file)
+		}
+	}
+}
+
+func TestBuildServerReleaseName(t *testing.T) {
+	buildServer := BuildServer{ReleaseNames: map[string]string{"7": "cheshire-cat", "7.6": "trinity", "7.6.2": "trinity-mp"}}
+	tests := []struct {
+		version string
+		want    string
+		ok      bool
+	}{
+		{"7.6.2-1234", "trinity-mp", true},
+		{"7.6.1-1234", "trinity", true},
+		{"7.2.0-1234", "cheshire-cat", true},
+		// Prefixes are whole components, so 7.6 doesn't match 7.60
+		{"7.60.0-1234", "cheshire-cat", true},
+		{"8.0.0-1234", "", false},
+	}
+
+	for _, test := range tests {
+		v, err := parseVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := buildServer.releaseName(v); got != test.want || ok != test.ok {
+			t.Errorf("%s: got %q, %t, want %q, %t", test.version, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	config := &Config{PackageMirrors: map[string]string{
+		"https://packages.couchbase.com/":                                 "https://mirror.example.com/couchbase/",
+		"https://packages.couchbase.com/releases/couchbase-sync-gateway/": "https://sgw-mirror.example.com/",
+	}}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://packages.couchbase.com/releases/7.6.2", "https://mirror.example.com/couchbase/releases/7.6.2"},
+		// The longest matching prefix wins
+		{"https://packages.couchbase.com/releases/couchbase-sync-gateway/3.2.0", "https://sgw-mirror.example.com/3.2.0"},
+		{"http://packages-staging.couchbase.com/releases/7.6.2", "http://packages-staging.couchbase.com/releases/7.6.2"},
+	}
+
+	for _, test := range tests {
+		if got := config.mirrorURL(test.url); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.url, got, test.want)
+		}
+	}
+}
+
+func TestMirrorImage(t *testing.T) {
+	config := &Config{RegistryMirrors: map[string]string{
+		"docker.io": "mirror.example.com/dockerhub",
+		"quay.io":   "mirror.example.com/quay",
+	}}
+	tests := []struct {
+		image string
+		want  string
+	}{
+		// Official images live under library/
+		{"ubuntu:24.04", "mirror.example.com/dockerhub/library/ubuntu:24.04"},
+		{"couchbase/server:7.6.2", "mirror.example.com/dockerhub/couchbase/server:7.6.2"},
+		{"docker.io/library/ubuntu:24.04", "mirror.example.com/dockerhub/library/ubuntu:24.04"},
+		{"quay.io/centos/centos:stream9", "mirror.example.com/quay/centos/centos:stream9"},
+		{"registry.example.com/ubuntu:24.04", "registry.example.com/ubuntu:24.04"},
+		{"localhost:5000/ubuntu:24.04", "localhost:5000/ubuntu:24.04"},
+	}
+
+	for _, test := range tests {
+		if got := config.mirrorImage(test.image); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.image, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Name of the file (relative to the "generate" directory) holding the
+// version customizations
+const versionCustomizationsFile = "version_customizations.json"
+
+// A map of "overrides" which specify custom package download urls, package
+// names, checksums, base images, architectures or arbitrary template
+// parameters for unreleased or otherwise special versions of any product.
+// Key format: $product_$edition_$version (eg, sync-gateway_community_2.0.0-latestbuild)
+type VersionCustomizations map[string]VersionCustomization
+
+// Parameters that can be customized. Every field is optional; anything
+// left empty falls back to the value the generator would normally compute.
+type VersionCustomization struct {
+	// Full package download URL and filename, which may contain
+	// @@ARCH@@ for the product's name of the architecture
+	PackageUrl      string `json:"package_url"`
+	PackageFilename string `json:"package_filename"`
+	// Base URL the package is downloaded from, replacing eg.
+	// https://packages.couchbase.com/releases/7.6.2
+	ReleaseUrl string `json:"release_url"`
+	// Package filename per architecture. The key "@@ARCH@@" may be used
+	// for a filename containing the @@ARCH@@ placeholder, which covers all
+	// architectures at once.
+	PackageFiles map[Arch]string `json:"package_files"`
+	// Expected SHA256 of the package per architecture. Specifying these
+	// means the .sha256 files need not be downloaded.
+	SHA256 map[Arch]string `json:"sha256"`
+	// Docker image to build FROM
+	BaseImage string `json:"base_image"`
+	// Architectures the image is built for
+	Arches []Arch `json:"arches"`
+	// Any additional template parameters; these are applied after all
+	// computed parameters, but before -t overrides on the command line
+	Params map[string]any `json:"params"`
+}
+
+// loadVersionCustomizations reads the version customizations from
+// generate/version_customizations.json under the given base directory.
+// A missing file is not an error; it simply means there are no
+// customizations.
+func loadVersionCustomizations(baseDir string) (VersionCustomizations, error) {
+	filename := path.Join(baseDir, "generate", versionCustomizationsFile)
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return VersionCustomizations{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	customizations := VersionCustomizations{}
+	if err := newStrictDecoder(data).Decode(&customizations); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if err := customizations.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return customizations, nil
+}
+
+// newStrictDecoder returns a JSON decoder for the generator's own files,
+// which rejects unknown fields: these are most likely typos (eg.
+// "package_uri"), which would otherwise silently be ignored
+func newStrictDecoder(data []byte) *json.Decoder {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder
+}
+
+// validate ensures that every key is of the form $product_$edition_$version
+// with a known product and edition, and reports all bad keys at once
+func (customizations VersionCustomizations) validate() error {
+	problems := []string{}
+	for key := range customizations {
+		product, edition, version, err := splitVersionCustomizationKey(key)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if !isKnownProduct(product) {
+			problems = append(problems, fmt.Sprintf("unknown product '%s' in key '%s'", product, key))
+		}
+		if !isKnownEdition(edition) {
+			problems = append(problems, fmt.Sprintf("unknown edition '%s' in key '%s'", edition, key))
+		}
+		if version == "" {
+			problems = append(problems, fmt.Sprintf("missing version in key '%s'", key))
+		}
+
+		customization := customizations[key]
+		for arch := range customization.PackageFiles {
+			if !isKnownArch(arch) {
+				problems = append(problems, fmt.Sprintf("unknown arch '%s' in package_files of '%s'", arch, key))
+			}
+		}
+		for arch := range customization.SHA256 {
+			if !isKnownArch(arch) || arch == Archgeneric {
+				problems = append(problems, fmt.Sprintf("unknown arch '%s' in sha256 of '%s'", arch, key))
+			}
+		}
+		for _, arch := range customization.Arches {
+			if !isKnownArch(arch) || arch == Archgeneric {
+				problems = append(problems, fmt.Sprintf("unknown arch '%s' in arches of '%s'", arch, key))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid version customizations:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// splitVersionCustomizationKey is the inverse of versionCustomizationKey()
+func splitVersionCustomizationKey(key string) (Product, Edition, string, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("key '%s' not of form PRODUCT_EDITION_VERSION", key)
+	}
+	return Product(parts[0]), Edition(parts[1]), parts[2], nil
+}
+
+func isKnownProduct(product Product) bool {
+	for _, p := range default_products {
+		if p == product {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownEdition(edition Edition) bool {
+	for _, e := range default_editions {
+		if e == edition {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownArch(arch Arch) bool {
+	return arch == Archamd64 || arch == Archarm64 || arch == Archgeneric
+}
+
+// packageFile returns the customized package filename for the given
+// arch, if any, where archName gives the product's name for an arch. A
+// request for a specific arch falls back to the "@@ARCH@@" entry with the
+// placeholder substituted. A request for Archgeneric falls back to the
+// entries for the arches of the variant, which must then differ only by
+// the arch, so that they can be written as a single filename containing
+// @@ARCH@@.
+func (customization VersionCustomization) packageFile(
+	arch Arch, arches []Arch, archName func(Arch) string,
+) (string, bool, error) {
+	if filename, ok := customization.PackageFiles[arch]; ok {
+		return filename, true, nil
+	}
+	if arch != Archgeneric {
+		if filename, ok := customization.PackageFiles[Archgeneric]; ok {
+			return strings.ReplaceAll(filename, string(Archgeneric), archName(arch)), true, nil
+		}
+		return "", false, nil
+	}
+	if len(arches) == 1 {
+		filename, ok := customization.PackageFiles[arches[0]]
+		return filename, ok, nil
+	}
+
+	pattern, found := "", 0
+	for _, a := range arches {
+		filename, ok := customization.PackageFiles[a]
+		if !ok {
+			continue
+		}
+		found++
+		if p := strings.ReplaceAll(filename, archName(a), string(Archgeneric)); pattern == "" {
+			pattern = p
+		} else if p != pattern {
+			pattern = ""
+			break
+		}
+	}
+	switch {
+	case found == 0:
+		return "", false, nil
+	case found < len(arches) || pattern == "":
+		return "", false, fmt.Errorf(
+			"package_files must have an %s entry, or entries for all of %v differing only by the arch", Archgeneric, arches)
+	}
+	return pattern, true, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import "testing"
+
+func TestVersionCustomizationPackageFile(t *testing.T) {
+	multiArch := []Arch{Archamd64, Archarm64}
+	tests := []struct {
+		name         string
+		product      Product
+		packageFiles map[Arch]string
+		arch         Arch
+		arches       []Arch
+		want         string
+		wantOK       bool
+		wantErr      bool
+	}{
+		{
+			name:   "no package files",
+			arch:   Archgeneric,
+			arches: multiArch,
+		},
+		{
+			name:         "arch entry",
+			packageFiles: map[Arch]string{Archamd64: "pkg_amd64.deb"},
+			arch:         Archamd64,
+			arches:       multiArch,
+			want:         "pkg_amd64.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "generic entry for an arch",
+			packageFiles: map[Arch]string{Archgeneric: "pkg_@@ARCH@@.deb"},
+			arch:         Archarm64,
+			arches:       multiArch,
+			want:         "pkg_arm64.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "generic entry",
+			packageFiles: map[Arch]string{Archgeneric: "pkg_@@ARCH@@.deb"},
+			arch:         Archgeneric,
+			arches:       multiArch,
+			want:         "pkg_@@ARCH@@.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "single arch",
+			packageFiles: map[Arch]string{Archamd64: "pkg_x86_64.rpm"},
+			arch:         Archgeneric,
+			arches:       []Arch{Archamd64},
+			want:         "pkg_x86_64.rpm",
+			wantOK:       true,
+		},
+		{
+			name:         "arch entries differing by the arch",
+			packageFiles: map[Arch]string{Archamd64: "pkg_amd64.deb", Archarm64: "pkg_arm64.deb"},
+			arch:         Archgeneric,
+			arches:       multiArch,
+			want:         "pkg_@@ARCH@@.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "generic entry for an arch named by the product",
+			product:      ProductSyncGw,
+			packageFiles: map[Arch]string{Archgeneric: "sgw_@@ARCH@@.deb"},
+			arch:         Archarm64,
+			arches:       multiArch,
+			want:         "sgw_aarch64.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "arch entries differing by the product's arch names",
+			product:      ProductSyncGw,
+			packageFiles: map[Arch]string{Archamd64: "sgw_x86_64.deb", Archarm64: "sgw_aarch64.deb"},
+			arch:         Archgeneric,
+			arches:       multiArch,
+			want:         "sgw_@@ARCH@@.deb",
+			wantOK:       true,
+		},
+		{
+			name:         "arch entries differing otherwise",
+			packageFiles: map[Arch]string{Archamd64: "pkg-1_amd64.deb", Archarm64: "pkg-2_arm64.deb"},
+			arch:         Archgeneric,
+			arches:       multiArch,
+			wantErr:      true,
+		},
+		{
+			name:         "arch entry missing",
+			packageFiles: map[Arch]string{Archamd64: "pkg_amd64.deb"},
+			arch:         Archgeneric,
+			arches:       multiArch,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			product := test.product
+			if product == "" {
+				product = ProductServer
+			}
+			variant := testVariant(product, EditionEnterprise, "7.6.2", test.arches...)
+			customization := VersionCustomization{PackageFiles: test.packageFiles}
+			got, ok, err := customization.packageFile(test.arch, test.arches, variant.archName)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("got %q, %t; want %q, %t", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+)
+
+// dryRunSummary collects the outcome for every file considered by a
+// --dry-run, as paths relative to the base directory
+type dryRunSummary struct {
+	Created   []string
+	Modified  []string
+	Deleted   []string
+	Unchanged []string
+}
+
+// previewVariant is the --dry-run equivalent of generateVariant(): it
+// renders the files that would be written and prints a unified diff
+// against the existing ones, including files that would be deleted from
+// the mirrored resource subdirectories. If regenerate is false, only the
+// README (which is always deployed) is considered.
+func previewVariant(variant DockerfileVariant, regenerate bool) error {
+	var files []renderedFile
+	if regenerate {
+		var err error
+		files, err = renderVariant(variant)
+		if err != nil {
+			return err
+		}
+		metadata, err := variant.renderMetadata()
+		if err != nil {
+			return err
+		}
+		files = append(files, metadata)
+	} else {
+		readme, err := renderReadme(variant)
+		if err != nil {
+			return err
+		}
+		files = []renderedFile{readme}
+	}
+
+	targetDir := variant.targetDir()
+	for _, file := range files {
+		filename := path.Join(targetDir, file.Path)
+
+		diff, err := diffRenderedFile(targetDir, file)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			variant.result.DryRun.Unchanged = append(variant.result.DryRun.Unchanged, filename)
+			continue
+		}
+
+		fmt.Fprint(&variant.result.stdout, diff)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			variant.result.DryRun.Created = append(variant.result.DryRun.Created, filename)
+		} else {
+			variant.result.DryRun.Modified = append(variant.result.DryRun.Modified, filename)
+		}
+	}
+
+	if !regenerate {
+		return nil
+	}
+	extra, err := extraMirroredFiles(variant, files)
+	if err != nil {
+		return err
+	}
+	for _, file := range extra {
+		filename := path.Join(targetDir, file)
+		diff, err := diffDeletedFile(filename)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(&variant.result.stdout, diff)
+		variant.result.DryRun.Deleted = append(variant.result.DryRun.Deleted, filename)
+	}
+	return nil
+}
+
+// add merges another summary into this one
+func (summary *dryRunSummary) add(other dryRunSummary) {
+	summary.Created = append(summary.Created, other.Created...)
+	summary.Modified = append(summary.Modified, other.Modified...)
+	summary.Deleted = append(summary.Deleted, other.Deleted...)
+	summary.Unchanged = append(summary.Unchanged, other.Unchanged...)
+}
+
+func (summary dryRunSummary) print() {
+	for _, filename := range summary.Created {
+		log.Printf("Would create: %s", filename)
+	}
+	for _, filename := range summary.Modified {
+		log.Printf("Would modify: %s", filename)
+	}
+	for _, filename := range summary.Deleted {
+		log.Printf("Would delete: %s", filename)
+	}
+	log.Printf("Dry run: %d created, %d modified, %d deleted, %d unchanged",
+		len(summary.Created), len(summary.Modified), len(summary.Deleted), len(summary.Unchanged))
+}
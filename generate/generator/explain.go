@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// runExplain prints how the variant for the given version is resolved:
+// every field of the DockerfileVariant, the values derived from them, and
+// every template parameter, each along with where it came from
+func (gen *Generator) runExplain(
+	edition Edition, product Product, ver string, overrides map[string]any,
+) error {
+	variant, err := gen.newVariant(edition, product, ver, "", overrides)
+	if err != nil {
+		return err
+	}
+	variant.result = &variantResult{Variant: variant}
+
+	// Include any settings the directory was generated with, just as bulk
+	// generation would
+	variant, err = variant.withSavedSettings()
+	if err != nil {
+		return err
+	}
+	// Only explains where values from the network would come from,
+	// without fetching them
+	variant.deferRemote = true
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+
+	fmt.Fprintf(out, "Variant %s/%s/%s\n\n", variant.Edition, variant.Product, variant.versionDirName())
+	fmt.Fprintln(out, "FIELD\tVALUE\tSET BY")
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"Edition", variant.Edition},
+		{"Product", variant.Product},
+		{"Version", variant.Version},
+		{"TargetVersion", variant.TargetVersion},
+		{"IsStaging", variant.IsStaging},
+		{"Arches", variant.Arches},
+		{"TemplateFilename", variant.TemplateFilename},
+		{"BaseImage", variant.BaseImage},
+		{"UbuntuVersion", variant.UbuntuVersion},
+		{"ExtraDeps", variant.ExtraDeps},
+		{"SystemdWorkaround", variant.SystemdWorkaround},
+		{"SkipChecksum", variant.SkipChecksum},
+		{"PinDigests", variant.PinDigests},
+	}
+	for _, field := range fields {
+		fmt.Fprintf(out, "%s\t%s\t%s\n", field.name, explainValue(field.value), variant.source(field.name))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "DERIVED\tVALUE\tFROM")
+	if err := explainDerived(out, variant); err != nil {
+		return err
+	}
+
+	params, sources, err := variant.resolveParams()
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "PARAMETER\tVALUE\tSET BY")
+	for _, key := range keys {
+		source := sources[key]
+		if strings.HasPrefix(key, "CB_SHA256_") || key == "CB_SKIP_CHECKSUM" {
+			source = "SHA256 verification (" + source + ")"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\n", key, explainValue(params[key]), source)
+	}
+	return nil
+}
+
+// explainDerived prints the values computed from the fields of the
+// variant, and which field, customization or product default each comes
+// from
+func explainDerived(out io.Writer, variant DockerfileVariant) error {
+	customization, hasCustomization := variant.versionCustomization()
+	customized := "version customization " + variant.versionCustomizationKey()
+	productDefault := fmt.Sprintf("default of product %s", variant.Product)
+
+	fmt.Fprintf(out, "Template\t%s\tTemplateFilename\n", variant.templateFile())
+
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return err
+	}
+	usesUbuntuVersion, err := variant.usesUbuntuVersion()
+	if err != nil {
+		return err
+	}
+	baseImageSource := productDefault
+	if hasCustomization && customization.BaseImage != "" {
+		baseImageSource = customized
+	} else if variant.BaseImage != "" {
+		baseImageSource = "BaseImage"
+	} else if usesUbuntuVersion {
+		baseImageSource = productDefault + ", from UbuntuVersion"
+	}
+	if isMirrored(baseImage, variant.gen.Config.RegistryMirrors) {
+		baseImageSource += ", via registry_mirrors"
+	}
+	if variant.PinDigests {
+		baseImageSource += ", pinned by " + baseImageLockFile
+	}
+	fmt.Fprintf(out, "Base image\t%s\t%s\n", baseImage, baseImageSource)
+
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return err
+	}
+	_, isBuild, err := variant.gen.Config.BuildServer.build(variant)
+	if err != nil {
+		return err
+	}
+	buildServer := "build_server of the config"
+	releaseURLSource := productDefault
+	if hasCustomization && customization.ReleaseUrl != "" {
+		releaseURLSource = customized
+	} else if isBuild {
+		releaseURLSource = buildServer
+	}
+	if isMirrored(releaseURL, variant.gen.Config.PackageMirrors) {
+		releaseURLSource += ", via package_mirrors"
+	}
+	fmt.Fprintf(out, "Release URL\t%s\t%s\n", releaseURL, releaseURLSource)
+
+	for _, arch := range variant.Arches {
+		// Not every product installs a package
+		if packageFile, err := variant.packageFile(arch); err != nil {
+			return err
+		} else if packageFile == "" {
+			continue
+		}
+		packageURL, err := variant.packageURL(arch)
+		if err != nil {
+			return err
+		}
+		packageSource := productDefault
+		if hasCustomization {
+			if _, ok, _ := customization.packageFile(arch, variant.Arches, variant.archName); ok || customization.PackageUrl != "" {
+				packageSource = customized
+			}
+		}
+		if packageSource == productDefault && isBuild {
+			packageSource = buildServer
+		}
+		if isMirrored(packageURL, variant.gen.Config.PackageMirrors) {
+			packageSource += ", via package_mirrors"
+		}
+		fmt.Fprintf(out, "Package (%s)\t%s\t%s\n", arch, packageURL, packageSource)
+	}
+
+	fmt.Fprintf(out, "Target directory\t%s\tEdition, Product, TargetVersion, IsStaging\n", variant.targetDir())
+	return nil
+}
+
+// isMirrored returns true if value was rewritten to one of the mirrors
+func isMirrored(value string, mirrors map[string]string) bool {
+	for _, mirror := range mirrors {
+		if strings.HasPrefix(value, mirror) {
+			return true
+		}
+	}
+	return false
+}
+
+// source returns where the given field of the variant got its value from
+func (variant DockerfileVariant) source(field string) string {
+	if source, ok := variant.provenance[field]; ok {
+		return source
+	}
+	return "default"
+}
+
+func explainValue(value any) string {
+	switch v := value.(type) {
+	case []Arch:
+		arches := []string{}
+		for _, arch := range v {
+			arches = append(arches, string(arch))
+		}
+		return strings.Join(arches, ",")
+	case string:
+		if v == "" {
+			return `""`
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
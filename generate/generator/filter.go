@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variantFilter restricts bulk generation to a subset of the version
+// directories. Empty fields match everything.
+type variantFilter struct {
+	Editions []Edition
+	Products []Product
+	Versions Constraints
+}
+
+// newVariantFilter builds a filter from comma-separated lists of editions
+// and products, and a version constraint string such as
+// ">= 7.6.0, < 8.0"
+func newVariantFilter(editions string, products string, versions string) (variantFilter, error) {
+	filter := variantFilter{}
+
+	for _, e := range splitList(editions) {
+		if !isKnownEdition(Edition(e)) {
+			return filter, fmt.Errorf("unknown edition '%s'", e)
+		}
+		filter.Editions = append(filter.Editions, Edition(e))
+	}
+
+	for _, p := range splitList(products) {
+		if !isKnownProduct(Product(p)) {
+			return filter, fmt.Errorf("unknown product '%s'", p)
+		}
+		filter.Products = append(filter.Products, Product(p))
+	}
+
+	if versions != "" {
+		constraints, err := parseConstraints(versions)
+		if err != nil {
+			return filter, fmt.Errorf("invalid version constraint '%s': %v", versions, err)
+		}
+		filter.Versions = constraints
+	}
+
+	return filter, nil
+}
+
+// Matches returns true if the version directory passes the filter. Note
+// that pre-release versions such as 7.0.0-beta only match constraints
+// which themselves mention a pre-release.
+func (filter variantFilter) Matches(dir versionDir) (bool, error) {
+	if len(filter.Editions) > 0 && !containsEdition(filter.Editions, dir.Edition) {
+		return false, nil
+	}
+	if len(filter.Products) > 0 && !containsProduct(filter.Products, dir.Product) {
+		return false, nil
+	}
+	if filter.Versions != nil {
+		v, err := parseVersion(strings.TrimSuffix(dir.Version, "-staging"))
+		if err != nil {
+			return false, fmt.Errorf("%s/%s/%s: %v", dir.Edition, dir.Product, dir.Version, err)
+		}
+		if !filter.Versions.Check(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func containsEdition(editions []Edition, edition Edition) bool {
+	for _, e := range editions {
+		if e == edition {
+			return true
+		}
+	}
+	return false
+}
+
+func containsProduct(products []Product, product Product) bool {
+	for _, p := range products {
+		if p == product {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated command line argument, ignoring
+// surrounding whitespace and empty entries
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,13 +1,13 @@
-//go:generate go run generate.go "../.."
+//go:generate go run . "../.."
 
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -17,7 +17,6 @@ import (
 	"text/template"
 
 	"github.com/docopt/docopt-go"
-	"github.com/hashicorp/go-version"
 )
 
 // Convert Dockerfile.template into version specific Dockerfile
@@ -30,17 +29,9 @@ const (
 	EditionCommunity  = Edition("community")
 )
 
+// Products are defined in product_*.go
 type Product string
 
-const (
-	ProductServer              = Product("couchbase-server")
-	ProductSyncGw              = Product("sync-gateway")
-	ProductSandbox             = Product("server-sandbox")
-	ProductColumnar            = Product("couchbase-columnar")
-	ProductEdgeServer          = Product("couchbase-edge-server")
-	ProductEnterpriseAnalytics = Product("enterprise-analytics")
-)
-
 // These are Docker's idea of architecture names, eg. amd64, arm64.
 // "Archgeneric" is for a filename with @@ARCH@@ in place of the
 // actual architecture, which will be substituted at build time in
@@ -53,16 +44,16 @@ const (
 	Archgeneric = Arch("@@ARCH@@")
 )
 
-// A map of "overrides" which specify custom package download urls and package names
-// for unreleased or otherwise special version.
-// Key format: $product_$edition_$version (eg, sync-gateway_community_2.0.0-latestbuild)
-// Note: currently only implemented for sync gateway
-type VersionCustomizations map[string]VersionCustomization
-
-// Parameters that can be customized
-type VersionCustomization struct {
-	PackageUrl      string `json:"package_url"`
-	PackageFilename string `json:"package_filename"`
+// unameArch returns the architecture as reported by `uname -m`, which is
+// what Sync Gateway uses in its package filenames
+func (arch Arch) unameArch() string {
+	switch arch {
+	case Archamd64:
+		return "x86_64"
+	case Archarm64:
+		return "aarch64"
+	}
+	return string(arch)
 }
 
 // ProductVersionFilter is a map of Product to a regular expression that should match versions
@@ -79,11 +70,9 @@ func (filter ProductVersionFilter) Matches(product Product, version string) bool
 }
 
 var (
-	default_editions      []Edition
-	default_products      []Product
-	versionCustomizations VersionCustomizations
-	baseDir               string
-	skipGeneration        ProductVersionFilter
+	default_editions []Edition
+	default_products []Product
+	skipGeneration   ProductVersionFilter
 )
 
 func init() {
@@ -92,26 +81,6 @@ func init() {
 		EditionEnterprise,
 	}
 
-	default_products = []Product{
-		ProductServer,
-		ProductSyncGw,
-		ProductSandbox,
-		ProductColumnar,
-		ProductEdgeServer,
-		ProductEnterpriseAnalytics,
-	}
-
-	// TODO: Read the version_customizations.json file into map
-	versionCustomizations = map[string]VersionCustomization{}
-	versionCustomizations["sync-gateway_community_2.0.0-devbuild"] = VersionCustomization{
-		PackageUrl:      "http://cbmobile-packages.s3.amazonaws.com/couchbase-sync-gateway-community_2.0.0-827_x86_64.rpm",
-		PackageFilename: "couchbase-sync-gateway-community_2.0.0-827_x86_64.rpm",
-	}
-	versionCustomizations["sync-gateway_enterprise_2.0.0-devbuild"] = VersionCustomization{
-		PackageUrl:      "http://cbmobile-packages.s3.amazonaws.com/couchbase-sync-gateway-enterprise_2.0.0-827_x86_64.rpm",
-		PackageFilename: "couchbase-sync-gateway-enterprise_2.0.0-827_x86_64.rpm",
-	}
-
 	skipGeneration = ProductVersionFilter{
 		ProductSyncGw: regexp.MustCompile(`^(1\.|2\.0\.).+$`), // 1.x and 2.0.x
 	}
@@ -121,17 +90,139 @@ func main() {
 	usage := `Dockerfile Generator
 
 Usage:
-  generate BASE_DIRECTORY -p PRODUCT -v VERSION -e EDITION -o DIR [ -t TEMPLATE_ARG ]...
-  generate BASE_DIRECTORY
+  generate BASE_DIRECTORY -p PRODUCT -v VERSION -e EDITION -o DIR [ -t TEMPLATE_ARG ]... [--overrides-file FILE] [--skip-checksum] [--offline] [--dry-run] [--prune] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]... [--pin-digests] [--registry-url URL]...
+  generate BASE_DIRECTORY [-e EDITIONS] [-p PRODUCTS] [--versions CONSTRAINTS] [--force] [-j JOBS] [--skip-checksum | --no-skip-checksum] [--offline] [--dry-run] [--prune] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]... [--pin-digests | --no-pin-digests] [--registry-url URL]...
+  generate check BASE_DIRECTORY [-e EDITIONS] [-p PRODUCTS] [--versions CONSTRAINTS] [-j JOBS] [--skip-checksum | --no-skip-checksum] [--offline] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]... [--pin-digests | --no-pin-digests] [--registry-url URL]...
+  generate list BASE_DIRECTORY [-e EDITIONS] [-p PRODUCTS] [--versions CONSTRAINTS] [--format FORMAT] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]...
+  generate audit-urls BASE_DIRECTORY [-e EDITIONS] [-p PRODUCTS] [--versions CONSTRAINTS] [--config FILE] [--allow-http HOST]...
+  generate refresh-bases BASE_DIRECTORY [-e EDITIONS] [-p PRODUCTS] [--versions CONSTRAINTS] [--apply] [-j JOBS] [--skip-checksum] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]... [--registry-url URL]...
+  generate explain BASE_DIRECTORY -p PRODUCT -v VERSION -e EDITION [ -t TEMPLATE_ARG ]... [--overrides-file FILE] [--skip-checksum | --no-skip-checksum] [--config FILE] [--package-mirror MIRROR]... [--registry-mirror MIRROR]... [--allow-http HOST]... [--pin-digests | --no-pin-digests]
 
 The first form generates a single Dockerfile and its associated resources
-in the specified directory (which must exist). The second form will
+in the specified directory (creating it if necessary). The second form will
 search for directories under the specified directory with the form
 
     EDITION/PRODUCT/VERSION
 
 and for each such directory that does not contain a Dockerfile, will
 create the corresponding Dockerfile with its associated resources.
+Directories whose template, resources or template parameters have
+changed since they were generated (as recorded in the
+.generate-metadata.json file in each directory) are regenerated too.
+--force regenerates directories which already contain a Dockerfile too.
+The directories considered may be limited with -e and -p (each a
+comma-separated list) and --versions, a version constraint such as
+'>= 7.6.0, < 8.0'. Pre-release versions like 7.0.0-beta and builds like
+7.0.0-5017 sort before 7.0.0, and only match constraints which
+themselves name a pre-release of the same version. Unlike in
+hashicorp/go-version, which the generator used to use, maintenance
+patches like 7.0.3-MP1 are releases: they sort after 7.0.3 (and
+7.0.3-MP10 after 7.0.3-MP2), so '> 7.0.3' matches them and '<= 7.0.3'
+doesn't.
+
+Directories generated by the first form with -t, --overrides-file,
+--skip-checksum or --pin-digests record these settings in a
+.generate-settings.json file, which the second form, "check" and
+"explain" read back, so regenerating the directory reproduces the same
+output. Running the first form again without them removes the file; the
+other forms never change it. Options given to the other forms take
+precedence over the saved settings, and --no-skip-checksum or
+--no-pin-digests turn off a saved setting.
+
+Template parameters may be overridden in the first form with -t
+KEY=VALUE, which sets a string, or -t KEY:TYPE=VALUE for other types,
+eg. -t CB_MULTIARCH:bool=false. --overrides-file reads a whole set of
+parameters, with their types, from a JSON or YAML object; -t arguments
+take precedence over it.
+
+With --dry-run, the first two forms write nothing. Instead they print a
+unified diff of every file they would create or modify, followed by a
+summary of created, modified, deleted and unchanged files.
+
+The scripts/ and config/ subdirectories of every directory generated are
+exact mirrors of generate/resources/PRODUCT/scripts and config; files
+removed from there are deleted. --prune additionally deletes, and lists,
+any file in the directories considered which comes from no template or
+resource. Combined with --dry-run, it only lists them.
+
+The "check" form renders every such directory in memory, and prints a
+unified diff for every generated file that no longer matches what the
+templates and resources would produce. It exits non-zero if anything
+has drifted. It writes nothing, not even the lockfiles: SHA256s and
+digests missing from them are only fetched for the check.
+
+The "list" form prints every EDITION/PRODUCT/VERSION directory, along
+with its architectures, base image (by tag, even if the directory was
+generated with --pin-digests), Ubuntu version, template and whether it
+is a staging version or skipped by bulk generation, as a table, JSON or
+CSV. It accepts the same filters as the second form.
+
+The "audit-urls" form lists every plain-http URL downloaded by the
+committed Dockerfiles matched by the filters. It exits non-zero if any
+of them could be fixed by regenerating the directory, ie. unless the
+directory is excluded from generation or the host is allowed.
+
+The "explain" form prints how the given version is resolved: every field
+of the variant with the rule, product default, customization or option
+which set it, the base image, URLs and so on derived from them, and
+every template parameter along with where it came from. It never uses
+the network: package SHA256s and base image digests are shown as where
+they would be fetched from.
+
+Generation fails if the SHA256 of any package can't be downloaded.
+--skip-checksum instead generates Dockerfiles which do not verify the
+downloaded packages at all; only use this if that's really intended.
+
+Every SHA256 downloaded is recorded in generate/checksums.lock.json and
+read from there on later runs. --offline fails generation for any
+package not yet recorded there, rather than going to the network.
+
+Settings of the generator itself, such as the layout of the build server
+which versions with a build number (eg. 8.1.0-1234) are downloaded from,
+are read from generate/generator.json if it exists, or from the file
+given with --config.
+
+For building inside restricted networks, --package-mirror URL=MIRROR
+downloads every package whose URL starts with URL from MIRROR instead,
+and --registry-mirror REGISTRY=MIRROR pulls base images from MIRROR
+rather than REGISTRY (docker.io for images such as ubuntu:24.04). Both
+may be repeated, and add to the package_mirrors and registry_mirrors of
+the generator settings.
+
+With --pin-digests, the first two forms and "check" pin every base image
+to a digest, eg. FROM ubuntu:24.04@sha256:..., so that every build of a
+Dockerfile uses the same base layers. Digests are recorded in
+generate/base-images.lock.json and read from there on later runs; tags
+not yet recorded are resolved through the Docker Registry HTTP API v2
+(failing if --offline). Images built for a single arch are pinned to that
+platform's manifest, and multi-arch images to the image index. As with
+--skip-checksum, the setting is recorded in .generate-settings.json.
+Every generated directory records the digest its base image was
+resolved to in its .generate-metadata.json, for "refresh-bases": the
+pinned digest, or without --pin-digests, whatever the tag resolves to at
+the time, if the registry can be reached.
+--registry-url REGISTRY=URL, or registry_urls in the generator settings,
+sets the API URL of a registry, eg. docker.io=http://localhost:5000 to
+use a local registry.
+
+The "refresh-bases" form resolves the base image of every directory
+matched by the filters through the registry, ignoring
+generate/base-images.lock.json, and lists those whose digest differs
+from the one recorded in their .generate-metadata.json when they were
+generated, ie. which would pick up a new base image when rebuilt.
+Directories without a recorded digest for their image are listed with
+an old digest of "-", and directories excluded from generation are left
+out. The PINNED column shows whether each directory pins its base image.
+With --apply, it regenerates the listed directories: those which pin
+their base image are pinned to the new digest, which is recorded in the
+lockfile, and the others only record the new digest. Directories not
+listed keep their digests, even if they use the same image.
+
+All package downloads must use https. Generation fails for any plain-http
+URL, unless its host is allowed with --allow-http HOST (which may be
+repeated) or in allow_http_hosts of the generator settings. Staging
+packages still come from packages-staging.couchbase.com over plain http,
+which is always allowed.
 
 Arguments:
   BASE_DIRECTORY                  Root of "docker" repository
@@ -140,271 +231,567 @@ Options:
   -p PRODUCT, --product PRODUCT   Product name
   -v VERSION, --version VERSION   Product version
   -e EDITION, --edition EDITION   Product edition (community/enterprise)
+  --versions CONSTRAINTS          Only versions matching the constraints
+  --force                         Overwrite existing Dockerfiles
+  -j JOBS, --jobs JOBS            Number of directories to process at once
+                                  [default: 4]
   -o OUTPUT_DIRECTORY             Directory to write Dockerfile to
-  -t TEMPLATE_ARG                 KEY=VALUE to provide to the template
+  -t TEMPLATE_ARG                 KEY=VALUE or KEY:TYPE=VALUE to provide to
+                                  the template; TYPE is string, bool, int
+                                  or list (comma-separated)
+  --overrides-file FILE           JSON or YAML file of template parameters
+  --skip-checksum                 Don't verify package SHA256 digests
+  --no-skip-checksum              Verify package SHA256 digests, even if
+                                  saved settings say not to
+  --offline                       Only use SHA256 digests from the lockfile
+  --dry-run                       Show what would change without writing
+  --prune                         Delete files from no template or resource
+  --format FORMAT                 Output format of "list": table, json or
+                                  csv [default: table]
+  --config FILE                   JSON file of generator settings
+  --package-mirror MIRROR         URL=MIRROR rewriting package downloads
+  --registry-mirror MIRROR        REGISTRY=MIRROR rewriting base images
+  --allow-http HOST               Allow plain-http downloads from HOST
+  --pin-digests                   Pin base images to digests
+  --no-pin-digests                Don't pin base images to digests, even
+                                  if saved settings say to
+  --registry-url URL              REGISTRY=URL of a registry's API
+  --apply                         Record new base image digests and
+                                  regenerate the directories using them
   -h, --help                      Print this usage message
 `
 
 	args, _ := docopt.ParseDoc(usage)
-	baseDir = args["BASE_DIRECTORY"].(string)
 
-	if args["--product"] != nil {
+	configFilename, _ := args["--config"].(string)
+	gen, err := newGenerator(args["BASE_DIRECTORY"].(string), configFilename)
+	if err != nil {
+		log.Fatalf("Failed to initialise: %v", err)
+	}
+	if err := addMappings(&gen.Config.PackageMirrors, args["--package-mirror"].([]string)); err != nil {
+		log.Fatalf("Invalid --package-mirror: %v", err)
+	}
+	if err := addMappings(&gen.Config.RegistryMirrors, args["--registry-mirror"].([]string)); err != nil {
+		log.Fatalf("Invalid --registry-mirror: %v", err)
+	}
+	if err := addMappings(&gen.Config.RegistryURLs, args["--registry-url"].([]string)); err != nil {
+		log.Fatalf("Invalid --registry-url: %v", err)
+	}
+	gen.Config.AllowHTTPHosts = append(gen.Config.AllowHTTPHosts, args["--allow-http"].([]string)...)
+	gen.SkipChecksum = newOptionalBool(args["--skip-checksum"].(bool), args["--no-skip-checksum"].(bool))
+	gen.PinDigests = newOptionalBool(args["--pin-digests"].(bool), args["--no-pin-digests"].(bool))
+	gen.Offline = args["--offline"].(bool)
+	if jobs, ok := args["--jobs"].(string); ok {
+		gen.Jobs, err = strconv.Atoi(jobs)
+		if err != nil || gen.Jobs < 1 {
+			log.Fatalf("--jobs must be a positive number, not '%s'", jobs)
+		}
+	}
+
+	if args["check"].(bool) {
+		log.Println("Checking generated files")
+		results, drifted, err := gen.runCheck(bulkFilter(args))
+		if err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		if failed := printSummary(results); failed > 0 {
+			log.Fatalf("Check failed for %d variant(s)", failed)
+		}
+		if drifted > 0 {
+			log.Fatalf("%d generated file(s) do not match the templates", drifted)
+		}
+		log.Printf("All generated files are up to date")
+		return
+	}
+
+	if args["list"].(bool) {
+		entries, err := gen.inventory(bulkFilter(args))
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		if err := writeInventory(os.Stdout, entries, args["--format"].(string)); err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		return
+	}
+
+	if args["audit-urls"].(bool) {
+		urls, err := gen.auditURLs(bulkFilter(args))
+		if err != nil {
+			log.Fatalf("Audit failed: %v", err)
+		}
+		if insecure := printAudit(os.Stdout, urls); insecure > 0 {
+			log.Fatalf("%d insecure download URL(s) found", insecure)
+		}
+		log.Printf("No insecure download URLs found")
+		return
+	}
+
+	if args["refresh-bases"].(bool) {
+		stale, err := gen.findStaleBases(bulkFilter(args))
+		if err != nil {
+			log.Fatalf("Refresh failed: %v", err)
+		}
+		printStaleBases(os.Stdout, stale)
+		if !args["--apply"].(bool) {
+			log.Printf("%d version(s) would pick up a new base image", len(stale))
+			return
+		}
+		results := gen.applyStaleBases(stale)
+		if err := gen.saveLocks(); err != nil {
+			log.Fatal(err)
+		}
+		if failed := printSummary(results); failed > 0 {
+			log.Fatalf("%d variant(s) failed", failed)
+		}
+		log.Printf("Recorded new base image digests for %d version(s)", len(stale))
+		return
+	}
+
+	if args["explain"].(bool) {
+		overrides, err := templateOverrides(args)
+		if err != nil {
+			log.Fatalf("Invalid template overrides: %v", err)
+		}
+		err = gen.runExplain(
+			Edition(args["--edition"].(string)),
+			Product(args["--product"].(string)),
+			args["--version"].(string),
+			overrides,
+		)
+		if err != nil {
+			log.Fatalf("Explain failed: %v", err)
+		}
+		return
+	}
+
+	gen.DryRun = args["--dry-run"].(bool)
+	gen.Prune = args["--prune"].(bool)
+
+	var results []*variantResult
+	if args["-o"] != nil {
 		log.Println("Generating single product")
-		generateOneDockerfile(
+		overrides, err := templateOverrides(args)
+		if err != nil {
+			log.Fatalf("Invalid template overrides: %v", err)
+		}
+		results, err = gen.generateOneDockerfile(
 			Edition(args["--edition"].(string)),
 			Product(args["--product"].(string)),
 			args["--version"].(string),
 			args["-o"].(string),
-			generateOverrides(args["-t"].([]string)),
+			overrides,
 			false,
 		)
 	} else {
 		log.Println("Generating multiple products")
-		generateAllDockerfiles()
+		results, err = gen.generateAllDockerfiles(bulkFilter(args), !args["--force"].(bool))
+	}
+	if err != nil {
+		log.Fatalf("Generation failed: %v", err)
+	}
+
+	dryRunResults := dryRunSummary{}
+	pruned := 0
+	for _, result := range results {
+		if result.Stale {
+			log.Printf("Regenerated stale directory: %s", result.Variant.targetDir())
+		}
+		dryRunResults.add(result.DryRun)
+		for _, filename := range result.Pruned {
+			if gen.DryRun {
+				log.Printf("Would prune: %s", filename)
+			} else {
+				log.Printf("Pruned: %s", filename)
+			}
+		}
+		pruned += len(result.Pruned)
+	}
+	if gen.DryRun {
+		dryRunResults.print()
+	}
+	if gen.Prune {
+		log.Printf("%d file(s) come from no template or resource", pruned)
+	}
+
+	// A dry run leaves the lockfiles alone too
+	if !gen.DryRun {
+		if err := gen.saveLocks(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if failed := printSummary(results); failed > 0 {
+		log.Fatalf("%d variant(s) failed", failed)
 	}
 
 	log.Printf("Successfully finished!")
 }
 
-func generateOverrides(args []string) (retval map[string]any) {
-
-	retval = map[string]any{}
-	for _, mapping := range args {
-		vals := strings.Split(mapping, "=")
-		if len(vals) != 2 {
-			log.Fatalf("-t '%s' not of form KEY=VALUE", mapping)
+// templateOverrides combines the parameters from --overrides-file, if
+// any, with those from -t arguments, which take precedence
+func templateOverrides(args docopt.Opts) (map[string]any, error) {
+	overrides := map[string]any{}
+	if filename, ok := args["--overrides-file"].(string); ok {
+		var err error
+		if overrides, err = loadOverridesFile(filename); err != nil {
+			return nil, err
 		}
-		retval[vals[0]] = vals[1]
 	}
 
-	return
+	flags, err := generateOverrides(args["-t"].([]string))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range flags {
+		overrides[key] = value
+	}
+	return overrides, nil
 }
 
-func generateAllDockerfiles() {
-	for _, edition := range default_editions {
-		for _, product := range default_products {
-			// find corresponding directory for this edition/product combo
-			dir := path.Join(baseDir, string(edition), string(product))
+// bulkFilter builds the variantFilter from the -e, -p and --versions
+// arguments of the bulk forms
+func bulkFilter(args docopt.Opts) variantFilter {
+	optional := func(key string) string {
+		if value, ok := args[key].(string); ok {
+			return value
+		}
+		return ""
+	}
 
-			// find all version subdirectories (must match regex)
-			versions := versionSubdirectories(dir)
+	filter, err := newVariantFilter(optional("--edition"), optional("--product"), optional("--versions"))
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+	return filter
+}
 
-			// for each version
-			for _, ver := range versions {
+func (gen *Generator) generateAllDockerfiles(filter variantFilter, noOverwrite bool) ([]*variantResult, error) {
+	variants, err := gen.matchingVariants(filter)
+	if err != nil {
+		return nil, err
+	}
 
-				if skipGeneration.Matches(product, ver) {
-					log.Printf("Skipping generation for %v %v %v", product, edition, ver)
-					continue
-				}
-				generateOneDockerfile(edition, product, ver, "", nil, true)
-			}
+	return gen.forEachVariant(variants, func(variant DockerfileVariant) error {
+		if skipGeneration.Matches(variant.Product, variant.versionDirName()) {
+			variant.log.Printf("Skipping generation for %v %v %v",
+				variant.Product, variant.Edition, variant.versionDirName())
+			variant.result.skip("excluded from generation")
+			return nil
+		}
+		// Reproduce any custom settings the directory was generated with
+		variant, err := variant.withSavedSettings()
+		if err != nil {
+			return err
 		}
+		if err := generateVariant(variant, noOverwrite); err != nil {
+			return err
+		}
+		if gen.Prune {
+			return pruneVariant(variant)
+		}
+		return nil
+	}), nil
+}
+
+// matchingVariants constructs the variant of every version directory
+// matched by the filter
+func (gen *Generator) matchingVariants(filter variantFilter) ([]DockerfileVariant, error) {
+	variants := []DockerfileVariant{}
+	for _, dir := range gen.allVersionDirs() {
+		if ok, err := filter.Matches(dir); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		variant, err := gen.newVariant(dir.Edition, dir.Product, dir.Version, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", variant.targetDir(), err)
+		}
+		variants = append(variants, variant)
 	}
+	return variants, nil
 }
 
-func generateOneDockerfile(
+// A generated EDITION/PRODUCT/VERSION directory in the repository
+type versionDir struct {
+	Edition Edition
+	Product Product
+	Version string
+}
+
+func (gen *Generator) generateOneDockerfile(
 	edition Edition, product Product, ver string, outputDir string,
 	overrides map[string]any, noOverwrite bool,
-) error {
+) ([]*variantResult, error) {
+	variant, err := gen.newVariant(edition, product, ver, outputDir, overrides)
+	if err != nil {
+		return nil, err
+	}
+	variant.saveSettings = true
+
+	// Now generate the Dockerfile(s) based on the constructed variant
+	return gen.forEachVariant([]DockerfileVariant{variant}, func(variant DockerfileVariant) error {
+		if err := generateVariant(variant, noOverwrite); err != nil {
+			return err
+		}
+		if gen.Prune {
+			return pruneVariant(variant)
+		}
+		return nil
+	}), nil
+}
+
+// newVariant constructs the DockerfileVariant for the given version
+// directory name, taking into account all the special cases of each
+// product
+func (gen *Generator) newVariant(
+	edition Edition, product Product, ver string, outputDir string,
+	overrides map[string]any,
+) (DockerfileVariant, error) {
 	// Start with a basic DockerfileVariant, then tweak if necessary
 	variant := DockerfileVariant{
+		gen:               gen,
+		log:               log.Default(),
 		Edition:           edition,
 		Product:           product,
 		Version:           strings.TrimSuffix(ver, "-staging"),
 		TargetVersion:     strings.TrimSuffix(ver, "-staging"),
-		Arches:            []Arch{Archamd64},
 		IsStaging:         strings.HasSuffix(ver, "-staging"),
-		TemplateFilename:  "Dockerfile.template",
 		OutputDir:         outputDir,
 		TemplateOverrides: overrides,
+		SkipChecksum:      gen.SkipChecksum.Value,
+		PinDigests:        gen.PinDigests.Value,
+		provenance:        map[string]string{},
+	}
+	variant.setBy("Edition", "command line or directory")
+	variant.setBy("Product", "command line or directory")
+	variant.setBy("Version", "command line or directory")
+	variant.setBy("TargetVersion", "command line or directory")
+	variant.setBy("IsStaging", "-staging suffix of the version")
+	if gen.SkipChecksum.Set {
+		variant.setBy("SkipChecksum", gen.SkipChecksum.flag("skip-checksum"))
+	}
+	if gen.PinDigests.Set {
+		variant.setBy("PinDigests", gen.PinDigests.flag("pin-digests"))
+	}
+	for key := range overrides {
+		variant.setBy("params."+key, "-t or --overrides-file")
 	}
 
-	productVer, _ := intVer(variant.Version)
-
-	// Update according to special cases based on Product and Version.
-	if product == ProductServer {
-		if productVer == 70003 {
-			// CBD-4603: 7.0.3 actually builds from 7.0.3-MP1 for complete
-			// Log4Shell remediation
-			variant.Version = "7.0.3-MP1"
-		}
-
-		if productVer >= 70100 {
-			// 7.1.0 and higher also support arm64
-			variant.Arches = append(variant.Arches, Archarm64)
-		}
-	} else if product == ProductSyncGw {
-		if productVer <= 30003 {
-			variant.TemplateFilename = "Dockerfile.centos.template"
-		} else {
-			variant.TemplateFilename = "Dockerfile.ubuntu.template"
-			variant.Arches = append(variant.Arches, Archarm64)
-		}
-	} else if product == ProductSandbox {
-		if productVer >= 71000 {
-			// 7.1.0 and higher also support arm64
-			variant.Arches = append(variant.Arches, Archarm64)
-		}
-	} else if product == ProductColumnar || product == ProductEnterpriseAnalytics {
-		variant.Arches = append(variant.Arches, Archarm64)
+	// Start with the product's architectures, then fill in the attributes
+	// of the variant according to the rules
+	if spec, ok := productSpecs[product]; ok {
+		variant.Arches = spec.Arches()
+		variant.setBy("Arches", fmt.Sprintf("default of product %s", product))
+	}
+	if err := gen.Rules.apply(&variant); err != nil {
+		return variant, err
 	}
 
-	// Now generate the Dockerfile(s) based on the constructed variant
-	if err := generateVariant(variant, noOverwrite); err != nil {
-		log.Fatalf("Failed (%v/%v/%v): %v", edition, product, ver, err)
+	// Finally apply any version customization
+	if customization, ok := variant.versionCustomization(); ok && len(customization.Arches) > 0 {
+		variant.Arches = customization.Arches
+		variant.setBy("Arches", "version customization "+variant.versionCustomizationKey())
 	}
 
-	return nil
+	return variant, nil
 }
 
 func generateVariant(variant DockerfileVariant, noOverwrite bool) error {
 	_, err := os.Stat(variant.dockerfile())
-	if noOverwrite && !os.IsNotExist(err) {
-		log.Printf("%s exists, not regenerating...", variant.dockerfile())
-	} else {
-		if err := generateDockerfile(variant); err != nil {
-			return err
-		}
+	regenerate := !noOverwrite || os.IsNotExist(err)
 
-		if err := deployScriptResources(variant); err != nil {
+	// An existing directory is still regenerated if anything it was
+	// generated from has changed since
+	if !regenerate {
+		stale, err := variant.staleInputs()
+		if err != nil {
 			return err
 		}
+		if len(stale) > 0 {
+			variant.log.Printf("%s is stale (changed: %s), regenerating...",
+				variant.targetDir(), strings.Join(stale, ", "))
+			variant.result.Stale = true
+			variant.result.Detail = "stale: " + strings.Join(stale, ", ")
+			regenerate = true
+		}
+	}
+
+	if variant.gen.DryRun {
+		return previewVariant(variant, regenerate)
+	}
+
+	if !regenerate {
+		variant.log.Printf("%s exists, not regenerating...", variant.dockerfile())
+		variant.result.skip("up to date")
+
+		// We always want to ensure the readme is updated, to avoid the current
+		// description on docker hub being overwritten by legacy documentation.
+		return deployReadme(variant)
+	}
+
+	// Everything is written to a staging copy of the directory, which only
+	// replaces the real one once all of it has succeeded
+	tx, err := beginDirTransaction(variant.targetDir())
+	if err != nil {
+		return err
+	}
+	staged := variant
+	staged.OutputDir = tx.staging
+
+	if err := writeVariantFiles(staged); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeVariantFiles writes all generated files for the variant into its
+// target directory
+func writeVariantFiles(variant DockerfileVariant) error {
+	if err := generateDockerfile(variant); err != nil {
+		return err
+	}
+
+	if err := deployResources(variant); err != nil {
+		return err
+	}
 
-		if err := deployConfigResources(variant); err != nil {
+	if variant.saveSettings {
+		if err := variant.writeSettings(); err != nil {
 			return err
 		}
 	}
 
-	// We always want to ensure the readme is updated, to avoid the current
-	// description on docker hub being overwritten by legacy documentation.
-	if err := deployReadme(variant); err != nil {
+	if err := variant.writeMetadata(); err != nil {
 		return err
 	}
 
-	return nil
+	return deployReadme(variant)
 }
 
 func generateDockerfile(variant DockerfileVariant) error {
-	log.Printf("generateDockerfile called with: %v", variant)
+	variant.log.Printf("generateDockerfile called with: %v/%v/%v %v",
+		variant.Edition, variant.Product, variant.Version, variant.Arches)
 
 	targetDir := variant.targetDir()
-	log.Printf("targetDir: %v", targetDir)
+	variant.log.Printf("targetDir: %v", targetDir)
 
 	// figure out output filename
 	targetDockerfile := variant.dockerfile()
-	log.Printf("targetDockerfile: %v", targetDockerfile)
+	variant.log.Printf("targetDockerfile: %v", targetDockerfile)
+
+	dockerfile, err := renderDockerfile(variant)
+	if err != nil {
+		return err
+	}
 
+	return writeFileAtomic(targetDockerfile, dockerfile, 0644)
+}
+
+// renderDockerfile renders the Dockerfile for the variant in memory
+func renderDockerfile(variant DockerfileVariant) ([]byte, error) {
 	// find the path to the source template
-	sourceTemplate := path.Join(
-		baseDir,
-		"generate",
-		"templates",
-		string(variant.Product),
-		string(variant.TemplateFilename),
-	)
+	sourceTemplate := variant.templateFile()
 
-	log.Printf("template: %v", sourceTemplate)
-	log.Printf("product: %v", variant.Product)
-	var params map[string]any
-
-	if variant.Product == ProductServer {
-		// template parameters
-		params = map[string]any{
-			"CB_VERSION":         variant.VersionWithSubstitutions(),
-			"CB_PACKAGE":         variant.serverPackageFile(Archgeneric),
-			"CB_PACKAGE_NAME":    variant.serverPackageName(),
-			"CB_EXTRA_DEPS":      variant.extraDependencies(),
-			"CB_SHA256_arm64":    variant.getSHA256(Archarm64),
-			"CB_SHA256_amd64":    variant.getSHA256(Archamd64),
-			"CB_RELEASE_URL":     variant.releaseURL(),
-			"DOCKER_BASE_IMAGE":  variant.dockerBaseImage(),
-			"PKG_COMMAND":        variant.serverPkgCommand(),
-			"SYSTEMD_WORKAROUND": variant.systemdWorkaround(),
-			"CB_MULTIARCH":       len(variant.Arches) > 1,
-			"CB_SKIP_CHECKSUM":   "false",
-		}
-
-	} else if variant.Product == ProductSyncGw {
-		// template parameters
-		params = map[string]any{
-			"SYNC_GATEWAY_PACKAGE_URL":      variant.sgPackageUrl(),
-			"SYNC_GATEWAY_PACKAGE_FILENAME": variant.sgPackageFilename(),
-			"DOCKER_BASE_IMAGE":             variant.dockerBaseImage(),
-		}
-
-	} else if variant.Product == ProductSandbox {
-		// template parameters
-		params = map[string]any{
-			"CB_VERSION":        variant.VersionWithSubstitutions(),
-			"DOCKER_BASE_IMAGE": variant.dockerBaseImage(),
-			"CB_MULTIARCH":      len(variant.Arches) > 1,
-		}
-
-	} else if variant.Product == ProductColumnar {
-		// template parameters
-		params = map[string]any{
-			"CB_VERSION":        variant.VersionWithSubstitutions(),
-			"CB_PACKAGE":        variant.columnarPackageFile(Archgeneric),
-			"CB_RELEASE_URL":    variant.releaseURL(),
-			"DOCKER_BASE_IMAGE": variant.dockerBaseImage(),
-			"CB_MULTIARCH":      len(variant.Arches) > 1,
-		}
-	} else if variant.Product == ProductEnterpriseAnalytics {
-		// template parameters
-		params = map[string]any{
-			"CB_VERSION":        variant.VersionWithSubstitutions(),
-			"CB_PACKAGE":        variant.enterpriseAnalyticsPackageFile(Archgeneric),
-			"CB_RELEASE_URL":    variant.releaseURL(),
-			"DOCKER_BASE_IMAGE": variant.dockerBaseImage(),
-			"CB_MULTIARCH":      len(variant.Arches) > 1,
-		}
-	} else if variant.Product == ProductEdgeServer {
-		// template parameters
-		params = map[string]any{
-			"CB_RELEASE_URL":    variant.releaseURL(),
-			"CB_PACKAGE_NAME":   variant.edgeServerPackageFile(Archgeneric),
-			"DOCKER_BASE_IMAGE": variant.dockerBaseImage(),
-		}
+	variant.log.Printf("template: %v", sourceTemplate)
+	variant.log.Printf("product: %v", variant.Product)
+
+	params, err := variant.templateParams()
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply any user-requested template overrides
-	for key, value := range variant.TemplateOverrides {
-		params[key] = value
+	templateBytes, err := ioutil.ReadFile(sourceTemplate)
+	if err != nil {
+		return nil, err
 	}
 
-	// open a file at destPath
-	out, err := os.Create(targetDockerfile)
+	tmpl, err := template.New("docker").Parse(string(templateBytes))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer out.Close()
 
-	templateBytes, err := ioutil.ReadFile(sourceTemplate)
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, params)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	tmpl, err := template.New("docker").Parse(string(templateBytes))
+	return out.Bytes(), nil
+}
+
+// templateFile returns the path to the source template for the variant
+func (variant DockerfileVariant) templateFile() string {
+	return path.Join(
+		variant.gen.BaseDir,
+		"generate",
+		"templates",
+		string(variant.Product),
+		string(variant.TemplateFilename),
+	)
+}
+
+// templateParams resolves the full set of parameters passed to the
+// variant's template
+func (variant DockerfileVariant) templateParams() (map[string]any, error) {
+	params, _, err := variant.resolveParams()
+	return params, err
+}
+
+// resolveParams resolves the template parameters of the variant, along
+// with where each one came from
+func (variant DockerfileVariant) resolveParams() (map[string]any, map[string]string, error) {
+	spec, err := variant.spec()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	err = tmpl.Execute(out, params)
+	params, err := spec.Params(variant)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	sources := map[string]string{}
+	for key := range params {
+		sources[key] = fmt.Sprintf("product %s", variant.Product)
 	}
 
-	return nil
+	// Apply any template parameters from the version customization
+	if customization, ok := variant.versionCustomization(); ok {
+		for key, value := range customization.Params {
+			params[key] = value
+			sources[key] = "version customization " + variant.versionCustomizationKey()
+		}
+	}
+
+	// Apply any user-requested template overrides
+	for key, value := range variant.TemplateOverrides {
+		params[key] = value
+		sources[key] = variant.provenance["params."+key]
+	}
+
+	return params, sources, nil
 }
 
 func deployResourcesSubdir(variant DockerfileVariant, subdir string) error {
 	srcDir := path.Join(
-		baseDir,
+		variant.gen.BaseDir,
 		"generate",
 		"resources",
 		string(variant.Product),
 		subdir,
 	)
 
+	targetDir := variant.targetDir()
+
+	destDir := path.Join(targetDir, subdir)
+
+	// The destination mirrors the source exactly, so anything removed or
+	// renamed in the source must not linger from earlier generations
+	if err := os.RemoveAll(destDir); err != nil {
+		return err
+	}
+
 	exists, err := exists(srcDir)
 	if err != nil {
 		return err
@@ -413,24 +800,27 @@ func deployResourcesSubdir(variant DockerfileVariant, subdir string) error {
 		return nil
 	}
 
-	targetDir := variant.targetDir()
-
-	destDir := path.Join(targetDir, subdir)
-
 	return CopyDir(srcDir, destDir)
 }
 
-func deployScriptResources(variant DockerfileVariant) error {
-	return deployResourcesSubdir(variant, "scripts")
-}
-
-func deployConfigResources(variant DockerfileVariant) error {
-	return deployResourcesSubdir(variant, "config")
+// deployResources deploys every resource subdirectory of the variant's
+// product
+func deployResources(variant DockerfileVariant) error {
+	spec, err := variant.spec()
+	if err != nil {
+		return err
+	}
+	for _, subdir := range spec.Resources() {
+		if err := deployResourcesSubdir(variant, subdir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func deployReadme(variant DockerfileVariant) error {
 	srcDir := path.Join(
-		baseDir,
+		variant.gen.BaseDir,
 		"generate",
 		"resources",
 		string(variant.Product),
@@ -440,11 +830,11 @@ func deployReadme(variant DockerfileVariant) error {
 	targetDir := variant.targetDir()
 	destFile := path.Join(targetDir, "README.md")
 
-	if err := CopyFile(srcFile, destFile); err != nil {
+	readme, err := os.ReadFile(srcFile)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return writeFileAtomic(destFile, readme, 0644)
 }
 
 func versionSubdirectories(dir string) []string {
@@ -469,26 +859,25 @@ func CopyFile(source string, dest string) (err error) {
 
 	defer sourcefile.Close()
 
-	destfile, err := os.Create(dest)
+	sourceinfo, err := sourcefile.Stat()
 	if err != nil {
 		return err
 	}
 
-	defer destfile.Close()
-
-	_, err = io.Copy(destfile, sourcefile)
-	if err == nil {
-		sourceinfo, err := os.Stat(source)
-		if err == nil {
-			err = os.Chmod(dest, sourceinfo.Mode())
-			if err != nil {
-				log.Printf("Error chmod %v", dest)
-			}
-		}
+	destfile, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
 
+	if _, err = io.Copy(destfile, sourcefile); err != nil {
+		destfile.Close()
+		return err
+	}
+	if err = destfile.Close(); err != nil {
+		return err
 	}
 
-	return
+	return os.Chmod(dest, sourceinfo.Mode())
 }
 
 func CopyDir(source string, dest string) (err error) {
@@ -505,9 +894,10 @@ func CopyDir(source string, dest string) (err error) {
 		return err
 	}
 
-	directory, _ := os.Open(source)
-
-	objects, err := directory.Readdir(-1)
+	objects, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
 
 	for _, obj := range objects {
 
@@ -518,19 +908,16 @@ func CopyDir(source string, dest string) (err error) {
 		if obj.IsDir() {
 			// create sub-directories - recursively
 			err = CopyDir(sourcefilepointer, destinationfilepointer)
-			if err != nil {
-				fmt.Println(err)
-			}
 		} else {
 			// perform copy
 			err = CopyFile(sourcefilepointer, destinationfilepointer)
-			if err != nil {
-				fmt.Println(err)
-			}
+		}
+		if err != nil {
+			return err
 		}
 
 	}
-	return
+	return nil
 }
 
 type DockerfileVariant struct {
@@ -543,232 +930,110 @@ type DockerfileVariant struct {
 	// is the directory name in this repository). 99.99% of the time
 	// this will be the same as Version, but very occasionally we need
 	// to translate a bit here
-	TargetVersion     string
-	TemplateFilename  string
-	Arches            []Arch
+	TargetVersion    string
+	TemplateFilename string
+	Arches           []Arch
+	// Docker image to build FROM; if empty, ubuntu:UbuntuVersion
+	BaseImage         string
+	UbuntuVersion     string
+	ExtraDeps         string
+	SystemdWorkaround bool
 	IsStaging         bool
 	OutputDir         string
 	TemplateOverrides map[string]any
+	// Whether the Dockerfile skips verifying the package SHA256
+	SkipChecksum bool
+	// Whether the base image is pinned to a digest
+	PinDigests bool
+
+	// Where each field, and each template override ("params.KEY"), got
+	// its value from, as shown by "explain"
+	provenance map[string]string
+	// Whether the settings are recorded in the directory, which only
+	// single mode does
+	saveSettings bool
+	// Whether values which are fetched from the network (package SHA256s
+	// and base image digests) are replaced by where they would be fetched
+	// from, so that the template parameters can be resolved offline
+	deferRemote bool
+
+	// The Generator this variant belongs to, and where it records its
+	// output while being processed
+	gen    *Generator
+	log    *log.Logger
+	result *variantResult
 }
 
-func (variant DockerfileVariant) getSHA256(arch Arch) string {
-	var sha256url string
-	if variant.Product == "couchbase-server" {
-		sha256url = variant.releaseURL() + "/" +
-			variant.serverPackageFile(arch) + ".sha256"
+// dockerBaseImage returns the image to build FROM, taking any version
+// customization, rule, registry mirror and digest pinning into account
+func (variant DockerfileVariant) dockerBaseImage() (string, error) {
+	image, err := variant.unpinnedBaseImage()
+	if err != nil || !variant.PinDigests {
+		return image, err
 	}
+	return variant.pinBaseImage(image)
+}
 
-	resp, err := http.Get(sha256url)
-	log.Print(sha256url)
+func (variant DockerfileVariant) unpinnedBaseImage() (string, error) {
+	mirror := variant.gen.Config.mirrorImage
 
-	if err != nil || resp.StatusCode != 200 {
-		log.Printf("Error downloading SHA256 file")
-		return "MISSING_SHA256_ERROR"
-	} else {
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error download content of SHA256 file")
-			return "HTTP_ERROR"
-		}
-		return strings.Fields(fmt.Sprintf("%s", body))[0]
+	if customization, ok := variant.versionCustomization(); ok && customization.BaseImage != "" {
+		return mirror(customization.BaseImage), nil
 	}
-}
 
-func (variant DockerfileVariant) dockerBaseImage() string {
-	switch variant.Product {
-	case ProductSyncGw:
-		productVer, _ := intVer(variant.Version)
-		if strings.Contains(variant.Version, "forestdb") {
-			return "tleyden5iwx/forestdb"
-		}
-		if productVer <= 30003 {
-			return "centos:centos7"
-		} else {
-			return fmt.Sprintf("ubuntu:%s", variant.ubuntuVersion())
-		}
-	case ProductEdgeServer:
-		return fmt.Sprintf("ubuntu:%s", variant.ubuntuVersion())
-	case ProductServer:
-		return fmt.Sprintf("ubuntu:%s", variant.ubuntuVersion())
-	case ProductSandbox:
-		return fmt.Sprintf("couchbase/server:%s", variant.Version)
-	case ProductColumnar:
-		return fmt.Sprintf("ubuntu:%s", variant.ubuntuVersion())
-	case ProductEnterpriseAnalytics:
-		return fmt.Sprintf("ubuntu:%s", variant.ubuntuVersion())
-	default:
-		log.Printf("Failed %v", variant.Product)
-		panic("Unexpected product")
+	if variant.BaseImage != "" {
+		return mirror(strings.ReplaceAll(variant.BaseImage, "@@VERSION@@", variant.Version)), nil
 	}
-}
-
-func (variant DockerfileVariant) serverPkgCommand() string {
-	// Currently all Server Dockerfiles are based on Ubuntu, so this is
-	// always "apt-get". However we did some work in the Dockerfile
-	// template to support "yum" as well. Leaving that in place for now
-	// in case we work on integrating the RHCC Dockerfile in future.
-	return "apt-get"
-}
 
-func (variant DockerfileVariant) systemdWorkaround() bool {
-	if variant.Product == ProductServer {
-		ver, _ := intVer(variant.Version)
-		if ver < 70000 {
-			return true
-		}
+	spec, err := variant.spec()
+	if err != nil {
+		return "", err
 	}
-	return false
+	baseImage, err := spec.BaseImage(variant)
+	if err != nil {
+		return "", err
+	}
+	return mirror(baseImage), nil
 }
 
-func intVer(v string) (int64, error) {
-	baseVer := strings.Split(v, "-")[0]
-	sections := strings.Split(baseVer, ".")
-	intVerSection := func(n int) string {
-		return fmt.Sprintf("%02s", sections[n])
+// usesUbuntuVersion reports whether the base image is the Ubuntu image of
+// the variant's UbuntuVersion (before any registry mirror), rather than
+// one given by a version customization, rule or the product
+func (variant DockerfileVariant) usesUbuntuVersion() (bool, error) {
+	if customization, ok := variant.versionCustomization(); ok && customization.BaseImage != "" {
+		return false, nil
 	}
-	s := ""
-	for i := 0; i < 3; i++ {
-		s += intVerSection(i)
+	if variant.BaseImage != "" || variant.UbuntuVersion == "" {
+		return false, nil
 	}
-	return strconv.ParseInt(s, 10, 64)
-}
-
-func (variant DockerfileVariant) isMadHatterOrNewer() bool {
-	ver, _ := intVer(variant.Version)
-	return ver >= 60500
-}
 
-func (variant DockerfileVariant) ubuntuVersion() string {
-	v1, err := version.NewVersion(variant.Version)
+	spec, err := variant.spec()
 	if err != nil {
-		log.Fatalf("go-version failed to parse %v", variant.Version)
+		return false, err
 	}
-	switch variant.Product {
-	case ProductSyncGw:
-		return "22.04"
-	case ProductEdgeServer:
-		return "24.04"
-	case ProductColumnar:
-		return "22.04"
-	case ProductEnterpriseAnalytics:
-		return "24.04"
-	case ProductServer:
-		version4, err := version.NewConstraint(">= 4.0, < 5.0")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 4.x: %v", err)
-		}
-		version5To6Dot0Dot0, err := version.NewConstraint(">= 5.0, <= 6.0.0")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 5.x--6.0.0: %v", err)
-		}
-		version6Dot0Dot1To6Dot6Dot1, err := version.NewConstraint(">= 6.0.1, <= 6.6.1")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 6.0.1--6.6.1: %v", err)
-		}
-		version6Dot6Dot2To7Dot1Dot6, err := version.NewConstraint(">= 6.6.2, <= 7.1.6")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 6.6.2--7.1.6: %v", err)
-		}
-		version7Dot2Dot0To7Dot2Dot5, err := version.NewConstraint(">= 7.2.0, <= 7.2.5")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 7.2.0--7.2.5: %v", err)
-		}
-		version7Dot6Dot0To7Dot6Dot1, err := version.NewConstraint(">= 7.6.0, <= 7.6.1")
-		if err != nil {
-			log.Fatalf("Error creating version constraint 7.6.0--7.6.1: %v", err)
-		}
-		if version4.Check(v1) {
-			return "14.04"
-		} else if version5To6Dot0Dot0.Check(v1) {
-			return "16.04"
-		} else if version6Dot0Dot1To6Dot6Dot1.Check(v1) {
-			return "18.04"
-		} else if version6Dot6Dot2To7Dot1Dot6.Check(v1) {
-			return "20.04"
-		} else if version7Dot2Dot0To7Dot2Dot5.Check(v1) {
-			return "22.04"
-		} else if version7Dot6Dot0To7Dot6Dot1.Check(v1) {
-			return "22.04"
-		}
-		return "24.04"
-	}
-	return ""
-}
-
-// Get the version for this variant, possibly doing substitutions
-func (variant DockerfileVariant) VersionWithSubstitutions() string {
-	if variant.Product == "sync-gateway" {
-		// if version is 0.0.0-xxx, replace with feature/xxx.
-		// (example: 0.0.0-forestdb -> feature/forestdb)
-		extraStuff := extraStuffAfterVersion(variant.Version)
-		switch extraStuff {
-		case "forestdb":
-			return fmt.Sprintf("feature/%v", extraStuff)
-		default:
-			return variant.Version
-		}
-	}
-	return variant.Version
-}
-
-// Given a version like "1.0.0" or "0.0.0-forestdb", return
-// the extra stuff after the version, like "" or "forestdb" (respectively)
-func extraStuffAfterVersion(version string) string {
-	re := regexp.MustCompile(`[0-9]*.[0-9]*.[0-9]*-?(.*)`)
-	result := re.FindStringSubmatch(version)
-	if len(result) > 1 {
-		group1 := result[1]
-		return group1
-	}
-	return ""
-}
-
-// Generate the package filename for this variant:
-// eg: couchbase-server-enterprise-7.1.1-linux_amd64.deb
-func (variant DockerfileVariant) serverPackageFile(arch Arch) string {
-	serverVer, _ := intVer(variant.Version)
-	if serverVer >= 70100 {
-		// From Neo onwards, use "linux" package since it's all the same.
-		return fmt.Sprintf(
-			"%v-%v_%v-linux_%v.deb",
-			variant.Product,
-			variant.Edition,
-			variant.Version,
-			arch,
-		)
-	} else {
-		// For earlier releases, no arm64 builds, so just hardcode amd64
-		return fmt.Sprintf(
-			"%v-%v_%v-ubuntu%v_amd64.deb",
-			variant.Product,
-			variant.Edition,
-			variant.Version,
-			variant.ubuntuVersion(),
-		)
+	baseImage, err := spec.BaseImage(variant)
+	if err != nil {
+		return false, err
 	}
+	ubuntuImage, err := ubuntuBaseImage(variant)
+	if err != nil {
+		return false, err
+	}
+	return baseImage == ubuntuImage, nil
 }
 
-// Generate the package name (couchbase-server or couchbase-server-community)
-// for this variant
-func (variant DockerfileVariant) serverPackageName() string {
-	if variant.Edition == EditionCommunity {
-		return "couchbase-server-community"
-	} else {
-		return "couchbase-server"
+func (variant DockerfileVariant) ubuntuVersion() (string, error) {
+	if variant.UbuntuVersion == "" {
+		return "", fmt.Errorf("no Ubuntu version known for %v %v", variant.Product, variant.Version)
 	}
+	return variant.UbuntuVersion, nil
 }
 
-// Specify any extra dependencies, based on variant
-func (variant DockerfileVariant) extraDependencies() string {
-	if variant.Product == "couchbase-server" {
-		if variant.isMadHatterOrNewer() {
-			return "bzip2"
-		} else {
-			return "python-httplib2"
-		}
+// setBy records where the given field of the variant got its value from
+func (variant DockerfileVariant) setBy(field string, source string) {
+	if variant.provenance != nil {
+		variant.provenance[field] = source
 	}
-	return ""
 }
 
 func (variant DockerfileVariant) targetDir() string {
@@ -777,95 +1042,71 @@ func (variant DockerfileVariant) targetDir() string {
 		return variant.OutputDir
 	}
 
-	// Here we use TargetVersion rather than Version
-	version := string(variant.TargetVersion)
-	if variant.IsStaging {
-		version = fmt.Sprintf("%s-staging", version)
-	}
 	targetDir := path.Join(
-		baseDir,
+		variant.gen.BaseDir,
 		string(variant.Edition),
 		string(variant.Product),
-		version,
+		variant.versionDirName(),
 	)
 	return targetDir
 }
 
+// versionDirName is the name of the variant's directory under
+// EDITION/PRODUCT, eg. "7.6.2" or "7.6.2-staging"
+func (variant DockerfileVariant) versionDirName() string {
+	// Here we use TargetVersion rather than Version
+	version := string(variant.TargetVersion)
+	if variant.IsStaging {
+		version = fmt.Sprintf("%s-staging", version)
+	}
+	return version
+}
+
 func (variant DockerfileVariant) dockerfile() string {
 	return path.Join(variant.targetDir(), "Dockerfile")
 }
 
-func (variant DockerfileVariant) releaseURL() string {
-	if variant.Product == ProductServer {
-		if variant.IsStaging {
-			return "http://packages-staging.couchbase.com/releases/" + variant.Version
-		} else {
-			return "https://packages.couchbase.com/releases/" + variant.Version
-		}
-	} else {
-		if variant.IsStaging {
-			return "http://packages-staging.couchbase.com/releases/" + string(variant.Product) + "/" + variant.Version
-		} else {
-			return "https://packages.couchbase.com/releases/" + string(variant.Product) + "/" + variant.Version
-		}
+// releaseURL returns the URL of the directory the package is downloaded
+// from, taking any version customization, build server and package
+// mirror into account. Plain-http URLs are refused unless allowed.
+func (variant DockerfileVariant) releaseURL() (string, error) {
+	releaseURL, err := variant.uncheckedReleaseURL()
+	if err != nil {
+		return "", err
 	}
-}
-
-// Find the package URL for this Sync Gateway version
-func (variant DockerfileVariant) sgPackageUrl() string {
-	var packagesBaseUrl string
-	if variant.IsStaging {
-		packagesBaseUrl = "http://packages-staging.couchbase.com/releases/couchbase-sync-gateway"
-	} else {
-		packagesBaseUrl = "http://packages.couchbase.com/releases/couchbase-sync-gateway"
+	if err := variant.gen.Config.checkURL(releaseURL); err != nil {
+		return "", err
 	}
+	return releaseURL, nil
+}
 
-	versionCustomization, hasCustomization := variant.versionCustomization()
+func (variant DockerfileVariant) uncheckedReleaseURL() (string, error) {
+	mirror := variant.gen.Config.mirrorURL
 
-	switch hasCustomization {
-	case true:
-		return fmt.Sprintf("%s", versionCustomization.PackageUrl)
-	default:
-		sgFileName := variant.sgPackageFilename()
+	if customization, ok := variant.versionCustomization(); ok && customization.ReleaseUrl != "" {
+		return mirror(customization.ReleaseUrl), nil
+	}
 
-		return fmt.Sprintf(
-			"%s/%s/%s",
-			packagesBaseUrl,
-			variant.Version,
-			sgFileName,
-		)
+	buildServer := variant.gen.Config.BuildServer
+	if v, ok, err := buildServer.build(variant); err != nil {
+		return "", err
+	} else if ok {
+		releaseURL, err := buildServer.releaseURL(variant, v)
+		return mirror(releaseURL), err
 	}
-}
 
-func (variant DockerfileVariant) sgPackageFilename() string {
-	versionCustomization, hasCustomization := variant.versionCustomization()
-	switch hasCustomization {
-	case true:
-		return fmt.Sprintf("%s", versionCustomization.PackageFilename)
-	default:
-		productVer, _ := intVer(variant.Version)
-		// Containers for SGW versions <= 3.0.3 were only produced for x64
-		if productVer <= 30003 {
-			return fmt.Sprintf(
-				"couchbase-sync-gateway-%s_%s_@@ARCH@@.rpm",
-				strings.ToLower(string(variant.Edition)),
-				variant.Version,
-			)
-		} else {
-			return fmt.Sprintf(
-				"couchbase-sync-gateway-%s_%s_@@ARCH@@.deb",
-				strings.ToLower(string(variant.Edition)),
-				variant.Version,
-			)
-		}
+	spec, err := variant.spec()
+	if err != nil {
+		return "", err
 	}
+	return mirror(spec.ReleaseURL(variant)), nil
 }
 
 func (variant DockerfileVariant) versionCustomization() (v VersionCustomization, exists bool) {
 	// eg, "sync-gateway_community_2.0.0-build
 	key := variant.versionCustomizationKey()
 
-	v, exists = versionCustomizations[key]
+	v, exists = variant.gen.Customizations[key]
 	return v, exists
 }
 
@@ -873,38 +1114,74 @@ func (variant DockerfileVariant) versionCustomizationKey() string {
 	return fmt.Sprintf("%s_%s_%s", variant.Product, variant.Edition, variant.Version)
 }
 
-// Generate the package filename for couchbase-edge-server:
-// eg: couchbase-edge-server_1.0.0_amd64.deb
-func (variant DockerfileVariant) edgeServerPackageFile(arch Arch) string {
-	return fmt.Sprintf(
-		"%v_%v_%v.deb",
-		variant.Product,
-		variant.Version,
-		arch,
-	)
+// packageFile returns the filename of the package installed for the
+// given arch, taking any version customization or build server into
+// account
+func (variant DockerfileVariant) packageFile(arch Arch) (string, error) {
+	if customization, ok := variant.versionCustomization(); ok {
+		if filename, ok, err := customization.packageFile(arch, variant.Arches, variant.archName); err != nil {
+			return "", fmt.Errorf("version customization %s: %v", variant.versionCustomizationKey(), err)
+		} else if ok {
+			return filename, nil
+		}
+		if customization.PackageFilename != "" {
+			return variant.expandArch(customization.PackageFilename, arch), nil
+		}
+	}
+
+	buildServer := variant.gen.Config.BuildServer
+	if v, ok, err := buildServer.build(variant); err != nil {
+		return "", err
+	} else if ok {
+		if filename, ok, err := buildServer.packageFile(variant, v, arch); err != nil || ok {
+			return filename, err
+		}
+	}
+
+	spec, err := variant.spec()
+	if err != nil {
+		return "", err
+	}
+	return spec.PackageFile(variant, arch)
 }
 
-// Generate the package filename for this variant:
-// eg: couchbase-columnar-enterprise-1.1.0-linux_amd64.deb
-func (variant DockerfileVariant) columnarPackageFile(arch Arch) string {
-	return fmt.Sprintf(
-		"%v-%v_%v-linux_%v.deb",
-		variant.Product,
-		variant.Edition,
-		variant.Version,
-		arch,
-	)
+// expandArch replaces @@ARCH@@ in a customized package filename or URL
+// with the product's name for the given arch. Archgeneric leaves it as is.
+func (variant DockerfileVariant) expandArch(s string, arch Arch) string {
+	if arch == Archgeneric {
+		return s
+	}
+	return strings.ReplaceAll(s, string(Archgeneric), variant.archName(arch))
 }
 
-// Generate the package filename for this variant:
-// eg: enterprise-analytics_2.0.0-linux_arm64.deb
-func (variant DockerfileVariant) enterpriseAnalyticsPackageFile(arch Arch) string {
-	return fmt.Sprintf(
-		"%v_%v-linux_%v.deb",
-		variant.Product,
-		variant.Version,
-		arch,
-	)
+// archName returns the product's name for the given arch in package
+// filenames
+func (variant DockerfileVariant) archName(arch Arch) string {
+	if spec, ok := productSpecs[variant.Product].(archNameSpec); ok {
+		return spec.ArchName(arch)
+	}
+	return string(arch)
+}
+
+// Generate the full package download URL for this variant and arch
+func (variant DockerfileVariant) packageURL(arch Arch) (string, error) {
+	if customization, ok := variant.versionCustomization(); ok && customization.PackageUrl != "" {
+		packageURL := variant.gen.Config.mirrorURL(variant.expandArch(customization.PackageUrl, arch))
+		if err := variant.gen.Config.checkURL(packageURL); err != nil {
+			return "", err
+		}
+		return packageURL, nil
+	}
+
+	packageFile, err := variant.packageFile(arch)
+	if err != nil {
+		return "", err
+	}
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return "", err
+	}
+	return releaseURL + "/" + packageFile, nil
 }
 
 // exists returns whether the given file or directory exists or not
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"text/tabwriter"
+)
+
+// Generator holds the settings and shared state of a single run of the
+// generator. Variants are processed concurrently, so everything here must
+// either be read-only once the run has started or safe for concurrent use.
+type Generator struct {
+	// Root of the "docker" repository
+	BaseDir        string
+	Config         *Config
+	Customizations VersionCustomizations
+	Rules          *Rules
+	ChecksumLock   *ChecksumLock
+	BaseImageLock  *BaseImageLock
+	// Skip verifying package SHA256s, and pin base images to the digests
+	// recorded in BaseImageLock. When not given on the command line, bulk
+	// mode reproduces whatever each directory was generated with.
+	SkipChecksum optionalBool
+	PinDigests   optionalBool
+	Offline      bool
+	DryRun       bool
+	// Delete files which come from no template or resource
+	Prune bool
+	// Maximum number of variants processed at once
+	Jobs int
+
+	// Digests base image tags resolved to during this run
+	images imageCache
+}
+
+// imageCache remembers what base image tags resolved to, so that each is
+// only looked up once per run however many variants use it. It is safe for
+// concurrent use.
+type imageCache struct {
+	digests map[string]ImageDigests
+	mutex   sync.Mutex
+}
+
+// resolveImage looks up the digests the given image tag resolves to in
+// its registry, bypassing the lockfile, unless it was already looked up
+// during this run
+func (gen *Generator) resolveImage(image string) (ImageDigests, error) {
+	gen.images.mutex.Lock()
+	digests, ok := gen.images.digests[image]
+	gen.images.mutex.Unlock()
+	if ok {
+		return digests, nil
+	}
+
+	digests, err := gen.Config.resolveImage(image)
+	if err != nil {
+		return ImageDigests{}, err
+	}
+
+	gen.images.mutex.Lock()
+	defer gen.images.mutex.Unlock()
+	if gen.images.digests == nil {
+		gen.images.digests = map[string]ImageDigests{}
+	}
+	gen.images.digests[image] = digests
+	return digests, nil
+}
+
+// newGenerator creates a Generator for the repository at baseDir, loading
+// the version customizations, rules and checksum lockfile from it, and the
+// generator settings from configFilename (or the default location if
+// empty)
+func newGenerator(baseDir string, configFilename string) (*Generator, error) {
+	config, err := loadConfig(baseDir, configFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	customizations, err := loadVersionCustomizations(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadRules(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := loadChecksumLock(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	baseImageLock, err := loadBaseImageLock(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Generator{
+		BaseDir:        baseDir,
+		Config:         config,
+		Customizations: customizations,
+		Rules:          rules,
+		ChecksumLock:   lock,
+		BaseImageLock:  baseImageLock,
+		Jobs:           1,
+	}, nil
+}
+
+type resultStatus string
+
+const (
+	statusSucceeded = resultStatus("succeeded")
+	statusSkipped   = resultStatus("skipped")
+	statusFailed    = resultStatus("failed")
+)
+
+// variantResult collects everything produced while processing a single
+// variant, so that the output of variants processed concurrently can be
+// printed in a deterministic order
+type variantResult struct {
+	Variant DockerfileVariant
+	Status  resultStatus
+	// Short explanation of the status, eg. why the variant was skipped
+	Detail string
+	Err    error
+	// Set if the variant's directory was regenerated because its inputs
+	// changed
+	Stale bool
+	// Number of drifted files found by "check"
+	Drifted int
+	DryRun  dryRunSummary
+	// Files deleted (or with --dry-run, to be deleted) by --prune
+	Pruned []string
+
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// forEachVariant calls fn for every variant, running up to gen.Jobs at
+// once. Each variant logs into its own buffers, which are copied to
+// stdout and stderr in the order of the variants as soon as all earlier
+// variants are done. The results are returned in the same order.
+func (gen *Generator) forEachVariant(
+	variants []DockerfileVariant, fn func(variant DockerfileVariant) error,
+) []*variantResult {
+	jobs := gen.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]*variantResult, len(variants))
+	done := make([]chan struct{}, len(variants))
+	for i := range variants {
+		results[i] = &variantResult{}
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, jobs)
+	for i := range variants {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := results[i]
+			variant := variants[i]
+			variant.result = result
+			variant.log = log.New(&result.stderr, "", log.LstdFlags)
+			result.Variant = variant
+
+			result.Err = fn(variant)
+			if result.Err != nil {
+				result.Status = statusFailed
+				result.Detail = result.Err.Error()
+			} else if result.Status == "" {
+				result.Status = statusSucceeded
+			}
+			close(done[i])
+		}(i)
+	}
+
+	for i, result := range results {
+		<-done[i]
+		os.Stdout.Write(result.stdout.Bytes())
+		os.Stderr.Write(result.stderr.Bytes())
+	}
+	wg.Wait()
+
+	return results
+}
+
+// skip marks the variant as skipped for the given reason
+func (result *variantResult) skip(reason string) {
+	result.Status = statusSkipped
+	result.Detail = reason
+}
+
+// printSummary prints a table with the status of every variant, followed
+// by the totals, and returns the number of failed variants
+func printSummary(results []*variantResult) int {
+	counts := map[resultStatus]int{}
+
+	table := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "STATUS\tEDITION\tPRODUCT\tVERSION\tDETAIL")
+	for _, result := range results {
+		v := result.Variant
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			result.Status, v.Edition, v.Product, v.versionDirName(), result.Detail)
+		counts[result.Status]++
+	}
+	table.Flush()
+
+	fmt.Fprintf(os.Stderr, "%d succeeded, %d skipped, %d failed\n",
+		counts[statusSucceeded], counts[statusSkipped], counts[statusFailed])
+	return counts[statusFailed]
+}
+
+// saveLocks writes back the checksum and base image lockfiles, if
+// anything was added to them
+func (gen *Generator) saveLocks() error {
+	if err := gen.ChecksumLock.Save(); err != nil {
+		return fmt.Errorf("failed to save checksum lockfile: %v", err)
+	}
+	if err := gen.BaseImageLock.Save(); err != nil {
+		return fmt.Errorf("failed to save base image lockfile: %v", err)
+	}
+	return nil
+}
+
+// allVersionDirs finds every EDITION/PRODUCT/VERSION directory under
+// the base directory, for all default editions and products
+func (gen *Generator) allVersionDirs() []versionDir {
+	dirs := []versionDir{}
+	for _, edition := range default_editions {
+		for _, product := range default_products {
+			// find corresponding directory for this edition/product combo
+			dir := path.Join(gen.BaseDir, string(edition), string(product))
+
+			// find all version subdirectories (must match regex)
+			for _, ver := range versionSubdirectories(dir) {
+				dirs = append(dirs, versionDir{edition, product, ver})
+			}
+		}
+	}
+	return dirs
+}
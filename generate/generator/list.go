@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// inventoryEntry describes a single generated directory, as listed by the
+// "list" command
+type inventoryEntry struct {
+	Edition Edition `json:"edition"`
+	Product Product `json:"product"`
+	// Name of the directory, eg. "7.0.3" or "7.6.2-staging"
+	Version string `json:"version"`
+	// Real version of the product, eg. "7.0.3-MP1"
+	ProductVersion string `json:"product_version"`
+	Arches         []Arch `json:"arches"`
+	BaseImage      string `json:"base_image"`
+	// Empty for images not based on Ubuntu
+	UbuntuVersion string `json:"ubuntu_version"`
+	Staging       bool   `json:"staging"`
+	Template      string `json:"template"`
+	// Whether bulk generation skips the directory
+	Skipped bool `json:"skipped"`
+}
+
+// Output formats of the "list" command
+var listFormats = []string{"table", "json", "csv"}
+
+// inventory computes an inventoryEntry for every generated directory
+// matched by the filter, taking the settings saved in each into account
+func (gen *Generator) inventory(filter variantFilter) ([]inventoryEntry, error) {
+	variants, err := gen.matchingVariants(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []inventoryEntry{}
+	for _, variant := range variants {
+		variant, err := variant.withSavedSettings()
+		if err != nil {
+			return nil, err
+		}
+		baseImage, err := variant.unpinnedBaseImage()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", variant.targetDir(), err)
+		}
+
+		ubuntuVersion := ""
+		if ok, err := variant.usesUbuntuVersion(); err != nil {
+			return nil, fmt.Errorf("%s: %v", variant.targetDir(), err)
+		} else if ok {
+			ubuntuVersion = variant.UbuntuVersion
+		}
+
+		entries = append(entries, inventoryEntry{
+			Edition:        variant.Edition,
+			Product:        variant.Product,
+			Version:        variant.versionDirName(),
+			ProductVersion: variant.Version,
+			Arches:         variant.Arches,
+			BaseImage:      baseImage,
+			UbuntuVersion:  ubuntuVersion,
+			Staging:        variant.IsStaging,
+			Template:       variant.TemplateFilename,
+			Skipped:        skipGeneration.Matches(variant.Product, variant.versionDirName()),
+		})
+	}
+	return entries, nil
+}
+
+// writeInventory writes the entries in the given format
+func writeInventory(out io.Writer, entries []inventoryEntry, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write(inventoryHeader)
+		for _, entry := range entries {
+			writer.Write(entry.fields())
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "table":
+		table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, strings.ToUpper(strings.Join(inventoryHeader, "\t")))
+		for _, entry := range entries {
+			fmt.Fprintln(table, strings.Join(entry.fields(), "\t"))
+		}
+		return table.Flush()
+	}
+
+	return fmt.Errorf("unknown format '%s' (expected %s)", format, strings.Join(listFormats, ", "))
+}
+
+// Column names of the csv and table formats, matching the json keys
+var inventoryHeader = []string{
+	"edition", "product", "version", "product_version", "arches",
+	"base_image", "ubuntu_version", "staging", "template", "skipped",
+}
+
+// fields returns the columns of the csv and table formats
+func (entry inventoryEntry) fields() []string {
+	arches := []string{}
+	for _, arch := range entry.Arches {
+		arches = append(arches, string(arch))
+	}
+	return []string{
+		string(entry.Edition),
+		string(entry.Product),
+		entry.Version,
+		entry.ProductVersion,
+		strings.Join(arches, ","),
+		entry.BaseImage,
+		entry.UbuntuVersion,
+		strconv.FormatBool(entry.Staging),
+		entry.Template,
+		strconv.FormatBool(entry.Skipped),
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestInventoryMirroredPinnedBaseImage(t *testing.T) {
+	baseDir := newTestRepo(t, "8.0.1")
+	settings := []byte(`{"pin_digests": true}`)
+	if err := os.WriteFile(path.Join(baseDir, "enterprise", "couchbase-server", "8.0.1", settingsFile), settings, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listing never resolves digests, even for a directory which pins them
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected registry request %s", r.URL)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	gen, err := newGenerator(baseDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Config.RegistryMirrors = map[string]string{"docker.io": "registry.example.com/dockerhub"}
+	gen.Config.RegistryURLs = map[string]string{"docker.io": srv.URL, "registry.example.com": srv.URL}
+	gen.Config.AllowHTTPHosts = []string{"127.0.0.1"}
+
+	entries, err := gen.inventory(variantFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.UbuntuVersion == "" {
+		t.Fatalf("no Ubuntu version for %s", entry.BaseImage)
+	}
+	if want := "registry.example.com/dockerhub/library/ubuntu:" + entry.UbuntuVersion; entry.BaseImage != want {
+		t.Errorf("base image %s, want %s", entry.BaseImage, want)
+	}
+}
+
+func TestInventoryNonUbuntuBaseImage(t *testing.T) {
+	baseDir := newTestRepo(t)
+	if err := os.MkdirAll(path.Join(baseDir, "enterprise", "server-sandbox", "7.6.2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := newGenerator(baseDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := gen.inventory(variantFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	if entry := entries[0]; entry.BaseImage != "couchbase/server:7.6.2" || entry.UbuntuVersion != "" {
+		t.Errorf("got base image %s, Ubuntu version %q", entry.BaseImage, entry.UbuntuVersion)
+	}
+}
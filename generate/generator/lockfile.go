@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+// lockFile is a JSON file under the "generate" directory recording values
+// looked up over the network, so that regenerating a Dockerfile doesn't
+// require the network and always produces the same result. The values are
+// kept by key in a single object, eg. {"checksums": {KEY: VALUE, ...}}. It
+// is safe for concurrent use.
+type lockFile[T any] struct {
+	filename string
+	// Name of the object holding the values
+	field   string
+	entries map[string]T
+	dirty   bool
+	mutex   sync.Mutex
+}
+
+// loadLockFile reads the named lockfile under the given base directory. A
+// missing file results in an empty lock.
+func loadLockFile[T any](baseDir string, name string, field string) (*lockFile[T], error) {
+	lock := &lockFile[T]{
+		filename: path.Join(baseDir, "generate", name),
+		field:    field,
+		entries:  map[string]T{},
+	}
+
+	data, err := os.ReadFile(lock.filename)
+	if os.IsNotExist(err) {
+		return lock, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	contents := map[string]map[string]T{}
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("%s: %v", lock.filename, err)
+	}
+	if entries := contents[field]; entries != nil {
+		lock.entries = entries
+	}
+	return lock, nil
+}
+
+// Save writes the lock back to disk, if anything was changed in it
+func (lock *lockFile[T]) Save() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if !lock.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(map[string]map[string]T{lock.field: lock.entries}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(lock.filename, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	lock.dirty = false
+	return nil
+}
+
+func (lock *lockFile[T]) get(key string) (T, bool) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	value, ok := lock.entries[key]
+	return value, ok
+}
+
+func (lock *lockFile[T]) set(key string, value T) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	lock.entries[key] = value
+	lock.dirty = true
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+)
+
+// Name of the file written into every generated directory, recording the
+// inputs it was generated from
+const metadataFile = ".generate-metadata.json"
+
+// generationMetadata records hashes of everything a generated directory
+// was produced from. If any of these change, the directory is stale and
+// bulk generation will regenerate it. Values fetched from the network
+// (package SHA256s and base image digests) are represented in Params by
+// where they are fetched from, so that checking for staleness doesn't
+// need the network.
+type generationMetadata struct {
+	Template  string `json:"template"`
+	Resources string `json:"resources"`
+	Params    string `json:"params"`
+	// The base image the directory was generated with, for refresh-bases.
+	// It isn't an input, so it's not compared by staleInputs().
+	BaseImage *baseImageRecord `json:"base_image,omitempty"`
+}
+
+// baseImageRecord is a base image tag and the digest it was resolved to
+// when the directory was generated, for the directory's arches
+type baseImageRecord struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+// currentMetadata computes the metadata the variant would be generated
+// with right now
+func (variant DockerfileVariant) currentMetadata() (generationMetadata, error) {
+	metadata := generationMetadata{}
+
+	template, err := os.ReadFile(variant.templateFile())
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Template = hashBytes(template)
+
+	resources, err := renderResources(variant)
+	if err != nil {
+		return metadata, err
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Path < resources[j].Path })
+	hash := sha256.New()
+	for _, file := range resources {
+		fmt.Fprintf(hash, "%s %o %d\n", file.Path, file.Mode, len(file.Content))
+		hash.Write(file.Content)
+	}
+	metadata.Resources = fmt.Sprintf("sha256:%x", hash.Sum(nil))
+
+	variant.deferRemote = true
+	params, err := variant.templateParams()
+	if err != nil {
+		return metadata, err
+	}
+	// encoding/json sorts map keys, so this is deterministic
+	paramsJson, err := json.Marshal(params)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Params = hashBytes(paramsJson)
+
+	return metadata, nil
+}
+
+func hashBytes(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func (variant DockerfileVariant) metadataFilename() string {
+	return path.Join(variant.targetDir(), metadataFile)
+}
+
+// readMetadata returns the metadata recorded in the variant's directory,
+// or nil if there is none
+func (variant DockerfileVariant) readMetadata() (*generationMetadata, error) {
+	data, err := os.ReadFile(variant.metadataFilename())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	metadata := &generationMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("%s: %v", variant.metadataFilename(), err)
+	}
+	return metadata, nil
+}
+
+func (variant DockerfileVariant) writeMetadata() error {
+	file, err := variant.renderMetadata()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(variant.metadataFilename(), file.Content, file.Mode)
+}
+
+// renderMetadata renders the metadata file of the variant in memory,
+// resolving its base image if necessary
+func (variant DockerfileVariant) renderMetadata() (renderedFile, error) {
+	metadata, err := variant.currentMetadata()
+	if err != nil {
+		return renderedFile{}, err
+	}
+	if metadata.BaseImage, err = variant.baseImageRecord(); err != nil {
+		return renderedFile{}, err
+	}
+	data, err := json.MarshalIndent(metadata, "", "    ")
+	if err != nil {
+		return renderedFile{}, err
+	}
+	return renderedFile{Path: metadataFile, Content: append(data, '\n'), Mode: 0644}, nil
+}
+
+// staleInputs returns which inputs of the variant's directory ("template",
+// "resources" or "params") differ from those it was generated with.
+// Directories without metadata (ie. generated before it was recorded) are
+// never considered stale, since there is no way to tell; regenerate them
+// with --force to start tracking them.
+func (variant DockerfileVariant) staleInputs() ([]string, error) {
+	recorded, err := variant.readMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil {
+		variant.log.Printf("%s has no %s, not checking for changes", variant.targetDir(), metadataFile)
+		return nil, nil
+	}
+
+	current, err := variant.currentMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []string{}
+	if recorded.Template != current.Template {
+		stale = append(stale, "template")
+	}
+	if recorded.Resources != current.Resources {
+		stale = append(stale, "resources")
+	}
+	if recorded.Params != current.Params {
+		stale = append(stale, "params")
+	}
+	return stale, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// appendFile appends data to the file, creating it if necessary
+func appendFile(t *testing.T, filename string, data string) {
+	t.Helper()
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleInputs(t *testing.T) {
+	tests := []struct {
+		name string
+		// change modifies the repository after generation
+		change    func(t *testing.T, baseDir string)
+		overrides map[string]any
+		want      []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, baseDir string) {},
+			want:   []string{},
+		},
+		{
+			name: "template",
+			change: func(t *testing.T, baseDir string) {
+				appendFile(t, path.Join(baseDir, "generate", "templates", "couchbase-server", "Dockerfile.template"), "\n# changed\n")
+			},
+			want: []string{"template"},
+		},
+		{
+			name: "resources",
+			change: func(t *testing.T, baseDir string) {
+				appendFile(t, path.Join(baseDir, "generate", "resources", "couchbase-server", "scripts", "entrypoint.sh"), "\n# changed\n")
+			},
+			want: []string{"resources"},
+		},
+		{
+			name: "new resource",
+			change: func(t *testing.T, baseDir string) {
+				appendFile(t, path.Join(baseDir, "generate", "resources", "couchbase-server", "scripts", "added.sh"), "#!/bin/sh\n")
+			},
+			want: []string{"resources"},
+		},
+		{
+			name:      "params",
+			change:    func(t *testing.T, baseDir string) {},
+			overrides: map[string]any{"CB_MULTIARCH": false},
+			want:      []string{"params"},
+		},
+		{
+			name: "template and params",
+			change: func(t *testing.T, baseDir string) {
+				appendFile(t, path.Join(baseDir, "generate", "templates", "couchbase-server", "Dockerfile.template"), "\n# changed\n")
+			},
+			overrides: map[string]any{"CB_MULTIARCH": false},
+			want:      []string{"template", "params"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseDir := newTestRepo(t, "7.6.2")
+			gen, err := newGenerator(baseDir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.Offline = true
+			gen.SkipChecksum = optionalBool{Value: true, Set: true}
+			results, err := gen.generateAllDockerfiles(variantFilter{}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkResults(t, results, 1)
+
+			test.change(t, baseDir)
+			variant, err := gen.newVariant(EditionEnterprise, ProductServer, "7.6.2", "", test.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := variant.staleInputs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStaleInputsWithoutMetadata(t *testing.T) {
+	baseDir := newTestRepo(t, "7.6.2")
+	gen, err := newGenerator(baseDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant, err := gen.newVariant(EditionEnterprise, ProductServer, "7.6.2", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Directories generated before metadata was recorded are never stale
+	if got, err := variant.staleInputs(); err != nil || got != nil {
+		t.Errorf("got %v, %v, want nothing", got, err)
+	}
+}
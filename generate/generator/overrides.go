@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// generateOverrides parses the -t arguments into template parameters. Each
+// is of the form KEY=VALUE or KEY:TYPE=VALUE, where TYPE is one of
+//
+//	string  the default
+//	bool    true or false (also 1/0, t/f, ...)
+//	int     a decimal integer
+//	list    comma-separated strings, eg. amd64,arm64 (empty for no items)
+//
+// Only the first "=" separates the key, so values may contain "=".
+func generateOverrides(args []string) (map[string]any, error) {
+	overrides := map[string]any{}
+	for _, mapping := range args {
+		key, value, err := parseOverride(mapping)
+		if err != nil {
+			return nil, err
+		}
+		overrides[key] = value
+	}
+	return overrides, nil
+}
+
+func parseOverride(mapping string) (string, any, error) {
+	key, value, ok := strings.Cut(mapping, "=")
+	if !ok || key == "" {
+		return "", nil, fmt.Errorf("-t '%s' not of form KEY=VALUE or KEY:TYPE=VALUE", mapping)
+	}
+
+	key, kind, typed := strings.Cut(key, ":")
+	if !typed {
+		return key, value, nil
+	}
+
+	switch kind {
+	case "string":
+		return key, value, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("-t '%s': '%s' is not a bool", mapping, value)
+		}
+		return key, b, nil
+	case "int":
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("-t '%s': '%s' is not an int", mapping, value)
+		}
+		return key, i, nil
+	case "list":
+		if value == "" {
+			return key, []string{}, nil
+		}
+		return key, strings.Split(value, ","), nil
+	}
+	return "", nil, fmt.Errorf("-t '%s': unknown type '%s' (expected string, bool, int or list)", mapping, kind)
+}
+
+// loadOverridesFile reads template parameters from a JSON or YAML file
+// (chosen by its .json, .yaml or .yml extension) holding a single object
+// of parameter names to values. Values keep their types, so eg. booleans
+// really are booleans in the template.
+func loadOverridesFile(filename string) (map[string]any, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]any{}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".json":
+		// Decode numbers ourselves, rather than making every one a float64
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&overrides); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for key, value := range overrides {
+			overrides[key] = normalizeJSONNumbers(value)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: overrides file must be .json, .yaml or .yml", filename)
+	}
+
+	return overrides, nil
+}
+
+// normalizeJSONNumbers turns every json.Number within value into an int
+// if it is one, and a float64 otherwise, matching what YAML produces
+func normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = normalizeJSONNumbers(v[i])
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = normalizeJSONNumbers(v[key])
+		}
+	}
+	return value
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		mapping string
+		key     string
+		want    any
+		wantErr bool
+	}{
+		{mapping: "CB_VERSION=7.6.2", key: "CB_VERSION", want: "7.6.2"},
+		{mapping: "CB_RELEASE_URL=http://example.com/?a=b", key: "CB_RELEASE_URL", want: "http://example.com/?a=b"},
+		{mapping: "CB_VERSION:string=7.6.2", key: "CB_VERSION", want: "7.6.2"},
+		{mapping: "CB_MULTIARCH:bool=false", key: "CB_MULTIARCH", want: false},
+		{mapping: "CB_MULTIARCH:bool=1", key: "CB_MULTIARCH", want: true},
+		{mapping: "RETRIES:int=3", key: "RETRIES", want: 3},
+		{mapping: "ARCHES:list=amd64,arm64", key: "ARCHES", want: []string{"amd64", "arm64"}},
+		{mapping: "ARCHES:list=", key: "ARCHES", want: []string{}},
+		{mapping: "CB_VERSION", wantErr: true},
+		{mapping: "=7.6.2", wantErr: true},
+		{mapping: "CB_MULTIARCH:bool=maybe", wantErr: true},
+		{mapping: "RETRIES:int=3.5", wantErr: true},
+		{mapping: "CB_VERSION:float=7.6", wantErr: true},
+	}
+
+	for _, test := range tests {
+		key, got, err := parseOverride(test.mapping)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s=%#v", test.mapping, key, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.mapping, err)
+		} else if key != test.key || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %s=%#v, want %s=%#v", test.mapping, key, got, test.key, test.want)
+		}
+	}
+}
+
+func TestLoadOverridesFile(t *testing.T) {
+	want := map[string]any{
+		"CB_VERSION":   "7.6.2",
+		"CB_MULTIARCH": false,
+		"RETRIES":      3,
+		"RATIO":        0.5,
+		"ARCHES":       []any{"amd64", "arm64"},
+	}
+	tests := []struct {
+		filename string
+		data     string
+		wantErr  bool
+	}{
+		{
+			filename: "overrides.json",
+			data:     `{"CB_VERSION": "7.6.2", "CB_MULTIARCH": false, "RETRIES": 3, "RATIO": 0.5, "ARCHES": ["amd64", "arm64"]}`,
+		},
+		{
+			filename: "overrides.yaml",
+			data:     "CB_VERSION: \"7.6.2\"\nCB_MULTIARCH: false\nRETRIES: 3\nRATIO: 0.5\nARCHES: [amd64, arm64]\n",
+		},
+		{filename: "overrides.yml", data: "- not an object\n", wantErr: true},
+		{filename: "overrides.json", data: `{"CB_VERSION": `, wantErr: true},
+		{filename: "overrides.toml", data: `CB_VERSION = "7.6.2"`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		filename := path.Join(t.TempDir(), test.filename)
+		if err := os.WriteFile(filename, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadOverridesFile(filename)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.filename, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.filename, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", test.filename, got, want)
+		}
+	}
+}
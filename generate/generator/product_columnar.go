@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+const ProductColumnar = Product("couchbase-columnar")
+
+type columnarSpec struct{}
+
+func init() {
+	registerProduct(columnarSpec{})
+}
+
+func (columnarSpec) Product() Product {
+	return ProductColumnar
+}
+
+func (columnarSpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	packageFile, err := variant.packageFile(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	return withSHA256Params(variant, map[string]any{
+		"CB_VERSION":        variant.Version,
+		"CB_PACKAGE":        packageFile,
+		"CB_RELEASE_URL":    releaseURL,
+		"DOCKER_BASE_IMAGE": baseImage,
+		"CB_MULTIARCH":      len(variant.Arches) > 1,
+	})
+}
+
+// Generate the package filename for this variant:
+// eg: couchbase-columnar-enterprise-1.1.0-linux_amd64.deb
+func (columnarSpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	return fmt.Sprintf(
+		"%v-%v_%v-linux_%v.deb",
+		variant.Product,
+		variant.Edition,
+		variant.Version,
+		arch,
+	), nil
+}
+
+func (columnarSpec) ReleaseURL(variant DockerfileVariant) string {
+	return releasesURL(variant, string(variant.Product))
+}
+
+func (columnarSpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return ubuntuBaseImage(variant)
+}
+
+func (columnarSpec) Arches() []Arch {
+	return []Arch{Archamd64, Archarm64}
+}
+
+func (columnarSpec) Resources() []string {
+	return []string{"scripts"}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+const ProductEdgeServer = Product("couchbase-edge-server")
+
+type edgeServerSpec struct{}
+
+func init() {
+	registerProduct(edgeServerSpec{})
+}
+
+func (edgeServerSpec) Product() Product {
+	return ProductEdgeServer
+}
+
+func (edgeServerSpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	packageFile, err := variant.packageFile(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	return withSHA256Params(variant, map[string]any{
+		"CB_RELEASE_URL":    releaseURL,
+		"CB_PACKAGE_NAME":   packageFile,
+		"DOCKER_BASE_IMAGE": baseImage,
+	})
+}
+
+// Generate the package filename for couchbase-edge-server:
+// eg: couchbase-edge-server_1.0.0_amd64.deb
+func (edgeServerSpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	return fmt.Sprintf(
+		"%v_%v_%v.deb",
+		variant.Product,
+		variant.Version,
+		arch,
+	), nil
+}
+
+func (edgeServerSpec) ReleaseURL(variant DockerfileVariant) string {
+	return releasesURL(variant, string(variant.Product))
+}
+
+func (edgeServerSpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return ubuntuBaseImage(variant)
+}
+
+func (edgeServerSpec) Arches() []Arch {
+	return []Arch{Archamd64, Archarm64}
+}
+
+func (edgeServerSpec) Resources() []string {
+	return []string{}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "fmt"
+
+const ProductEnterpriseAnalytics = Product("enterprise-analytics")
+
+type enterpriseAnalyticsSpec struct{}
+
+func init() {
+	registerProduct(enterpriseAnalyticsSpec{})
+}
+
+func (enterpriseAnalyticsSpec) Product() Product {
+	return ProductEnterpriseAnalytics
+}
+
+func (enterpriseAnalyticsSpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	packageFile, err := variant.packageFile(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	return withSHA256Params(variant, map[string]any{
+		"CB_VERSION":        variant.Version,
+		"CB_PACKAGE":        packageFile,
+		"CB_RELEASE_URL":    releaseURL,
+		"DOCKER_BASE_IMAGE": baseImage,
+		"CB_MULTIARCH":      len(variant.Arches) > 1,
+	})
+}
+
+// Generate the package filename for this variant:
+// eg: enterprise-analytics_2.0.0-linux_arm64.deb
+func (enterpriseAnalyticsSpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	return fmt.Sprintf(
+		"%v_%v-linux_%v.deb",
+		variant.Product,
+		variant.Version,
+		arch,
+	), nil
+}
+
+func (enterpriseAnalyticsSpec) ReleaseURL(variant DockerfileVariant) string {
+	return releasesURL(variant, string(variant.Product))
+}
+
+func (enterpriseAnalyticsSpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return ubuntuBaseImage(variant)
+}
+
+func (enterpriseAnalyticsSpec) Arches() []Arch {
+	return []Arch{Archamd64, Archarm64}
+}
+
+func (enterpriseAnalyticsSpec) Resources() []string {
+	return []string{"scripts"}
+}
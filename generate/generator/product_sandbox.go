@@ -0,0 +1,51 @@
+package main
+
+import "fmt"
+
+const ProductSandbox = Product("server-sandbox")
+
+type sandboxSpec struct{}
+
+func init() {
+	registerProduct(sandboxSpec{})
+}
+
+func (sandboxSpec) Product() Product {
+	return ProductSandbox
+}
+
+// The sandbox installs no package of its own, so doesn't verify any
+// SHA256 either
+func (sandboxSpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"CB_VERSION":        variant.Version,
+		"DOCKER_BASE_IMAGE": baseImage,
+		"CB_MULTIARCH":      len(variant.Arches) > 1,
+	}, nil
+}
+
+func (sandboxSpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	return "", nil
+}
+
+func (sandboxSpec) ReleaseURL(variant DockerfileVariant) string {
+	return releasesURL(variant, string(variant.Product))
+}
+
+// The sandbox is built on top of the Couchbase Server image
+func (sandboxSpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return fmt.Sprintf("couchbase/server:%s", variant.Version), nil
+}
+
+func (sandboxSpec) Arches() []Arch {
+	return []Arch{Archamd64}
+}
+
+func (sandboxSpec) Resources() []string {
+	return []string{"scripts"}
+}
@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+const ProductServer = Product("couchbase-server")
+
+type serverSpec struct{}
+
+func init() {
+	registerProduct(serverSpec{})
+}
+
+func (serverSpec) Product() Product {
+	return ProductServer
+}
+
+func (serverSpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	packageFile, err := variant.packageFile(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+	releaseURL, err := variant.releaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	return withSHA256Params(variant, map[string]any{
+		"CB_VERSION":         variant.Version,
+		"CB_PACKAGE":         packageFile,
+		"CB_PACKAGE_NAME":    serverPackageName(variant),
+		"CB_EXTRA_DEPS":      variant.ExtraDeps,
+		"CB_RELEASE_URL":     releaseURL,
+		"DOCKER_BASE_IMAGE":  baseImage,
+		"PKG_COMMAND":        serverPkgCommand(),
+		"SYSTEMD_WORKAROUND": variant.SystemdWorkaround,
+		"CB_MULTIARCH":       len(variant.Arches) > 1,
+	})
+}
+
+// Generate the package filename for this variant:
+// eg: couchbase-server-enterprise-7.1.1-linux_amd64.deb
+func (serverSpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	serverVer, err := parseVersion(variant.Version)
+	if err != nil {
+		return "", err
+	}
+	if serverVer.Core().Compare(mustParseVersion("7.1.0")) >= 0 {
+		// From Neo onwards, use "linux" package since it's all the same.
+		return fmt.Sprintf(
+			"%v-%v_%v-linux_%v.deb",
+			variant.Product,
+			variant.Edition,
+			variant.Version,
+			arch,
+		), nil
+	} else {
+		// For earlier releases, no arm64 builds, so just hardcode amd64
+		ubuntuVersion, err := variant.ubuntuVersion()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(
+			"%v-%v_%v-ubuntu%v_amd64.deb",
+			variant.Product,
+			variant.Edition,
+			variant.Version,
+			ubuntuVersion,
+		), nil
+	}
+}
+
+func (serverSpec) ReleaseURL(variant DockerfileVariant) string {
+	return releasesURL(variant, "")
+}
+
+func (serverSpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return ubuntuBaseImage(variant)
+}
+
+func (serverSpec) Arches() []Arch {
+	return []Arch{Archamd64}
+}
+
+func (serverSpec) Resources() []string {
+	return []string{"scripts"}
+}
+
+// Generate the package name (couchbase-server or couchbase-server-community)
+// for this variant
+func serverPackageName(variant DockerfileVariant) string {
+	if variant.Edition == EditionCommunity {
+		return "couchbase-server-community"
+	} else {
+		return "couchbase-server"
+	}
+}
+
+func serverPkgCommand() string {
+	// Currently all Server Dockerfiles are based on Ubuntu, so this is
+	// always "apt-get". However we did some work in the Dockerfile
+	// template to support "yum" as well. Leaving that in place for now
+	// in case we work on integrating the RHCC Dockerfile in future.
+	return "apt-get"
+}
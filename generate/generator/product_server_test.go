@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestServerPackageFile(t *testing.T) {
+	tests := []struct {
+		version       string
+		ubuntuVersion string
+		arch          Arch
+		want          string
+	}{
+		{"7.6.2", "24.04", Archgeneric, "couchbase-server-enterprise_7.6.2-linux_@@ARCH@@.deb"},
+		{"7.6.2", "24.04", Archarm64, "couchbase-server-enterprise_7.6.2-linux_arm64.deb"},
+		{"7.1.0", "20.04", Archamd64, "couchbase-server-enterprise_7.1.0-linux_amd64.deb"},
+		// Before 7.1.0 there were only amd64 packages, per Ubuntu version
+		{"7.0.3", "20.04", Archgeneric, "couchbase-server-enterprise_7.0.3-ubuntu20.04_amd64.deb"},
+		{"7.0.3-MP1", "20.04", Archamd64, "couchbase-server-enterprise_7.0.3-MP1-ubuntu20.04_amd64.deb"},
+	}
+
+	for _, test := range tests {
+		variant := testVariant(ProductServer, EditionEnterprise, test.version, Archamd64)
+		variant.UbuntuVersion = test.ubuntuVersion
+		got, err := serverSpec{}.PackageFile(variant, test.arch)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.version, test.arch, err)
+		} else if got != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.version, test.arch, got, test.want)
+		}
+	}
+}
+
+func TestServerReleaseURL(t *testing.T) {
+	variant := testVariant(ProductServer, EditionEnterprise, "7.6.2", Archamd64)
+	if got, want := (serverSpec{}).ReleaseURL(variant), "https://packages.couchbase.com/releases/7.6.2"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	variant.IsStaging = true
+	if got, want := (serverSpec{}).ReleaseURL(variant), "http://packages-staging.couchbase.com/releases/7.6.2"; got != want {
+		t.Errorf("staging: got %s, want %s", got, want)
+	}
+}
+
+func TestServerParams(t *testing.T) {
+	enterprise := testVariant(ProductServer, EditionEnterprise, "7.6.2", Archamd64, Archarm64)
+	checkParams(t, enterprise, map[string]any{
+		"CB_VERSION":        "7.6.2",
+		"CB_PACKAGE":        "couchbase-server-enterprise_7.6.2-linux_@@ARCH@@.deb",
+		"CB_PACKAGE_NAME":   "couchbase-server",
+		"CB_RELEASE_URL":    "https://packages.couchbase.com/releases/7.6.2",
+		"DOCKER_BASE_IMAGE": "ubuntu:24.04",
+		"CB_MULTIARCH":      true,
+		"CB_SKIP_CHECKSUM":  "true",
+	})
+
+	community := testVariant(ProductServer, EditionCommunity, "7.6.2", Archamd64)
+	checkParams(t, community, map[string]any{
+		"CB_PACKAGE":      "couchbase-server-community_7.6.2-linux_@@ARCH@@.deb",
+		"CB_PACKAGE_NAME": "couchbase-server-community",
+		"CB_MULTIARCH":    false,
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ProductSyncGw = Product("sync-gateway")
+
+type syncGatewaySpec struct{}
+
+func init() {
+	registerProduct(syncGatewaySpec{})
+}
+
+func (syncGatewaySpec) Product() Product {
+	return ProductSyncGw
+}
+
+func (syncGatewaySpec) Params(variant DockerfileVariant) (map[string]any, error) {
+	baseImage, err := variant.dockerBaseImage()
+	if err != nil {
+		return nil, err
+	}
+	packageURL, err := variant.packageURL(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+	packageFile, err := variant.packageFile(Archgeneric)
+	if err != nil {
+		return nil, err
+	}
+
+	return withSHA256Params(variant, map[string]any{
+		"SYNC_GATEWAY_PACKAGE_URL":      packageURL,
+		"SYNC_GATEWAY_PACKAGE_FILENAME": packageFile,
+		"DOCKER_BASE_IMAGE":             baseImage,
+	})
+}
+
+// Sync Gateway package filenames use `uname -m` architecture names, eg.
+// couchbase-sync-gateway-enterprise_3.1.0_x86_64.deb
+func (syncGatewaySpec) PackageFile(variant DockerfileVariant, arch Arch) (string, error) {
+	productVer, err := parseVersion(variant.Version)
+	if err != nil {
+		return "", err
+	}
+	// Containers for SGW versions <= 3.0.3 were only produced for x64
+	packageType := "deb"
+	if productVer.Core().Compare(mustParseVersion("3.0.3")) <= 0 {
+		packageType = "rpm"
+	}
+	return fmt.Sprintf(
+		"couchbase-sync-gateway-%s_%s_%s.%s",
+		strings.ToLower(string(variant.Edition)),
+		variant.Version,
+		arch.unameArch(),
+		packageType,
+	), nil
+}
+
+func (syncGatewaySpec) ArchName(arch Arch) string {
+	return arch.unameArch()
+}
+
+func (syncGatewaySpec) ReleaseURL(variant DockerfileVariant) string {
+	if variant.IsStaging {
+		return "http://" + stagingHost + "/releases/couchbase-sync-gateway/" + variant.Version
+	}
+	return "https://packages.couchbase.com/releases/couchbase-sync-gateway/" + variant.Version
+}
+
+func (syncGatewaySpec) BaseImage(variant DockerfileVariant) (string, error) {
+	return ubuntuBaseImage(variant)
+}
+
+func (syncGatewaySpec) Arches() []Arch {
+	return []Arch{Archamd64, Archarm64}
+}
+
+func (syncGatewaySpec) Resources() []string {
+	return []string{"scripts", "config"}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestSyncGatewayPackageFile(t *testing.T) {
+	tests := []struct {
+		version string
+		arch    Arch
+		want    string
+	}{
+		{"3.1.0", Archamd64, "couchbase-sync-gateway-enterprise_3.1.0_x86_64.deb"},
+		{"3.1.0", Archarm64, "couchbase-sync-gateway-enterprise_3.1.0_aarch64.deb"},
+		{"3.1.0", Archgeneric, "couchbase-sync-gateway-enterprise_3.1.0_@@ARCH@@.deb"},
+		// Up to 3.0.3 only rpm packages were used
+		{"3.0.3", Archamd64, "couchbase-sync-gateway-enterprise_3.0.3_x86_64.rpm"},
+	}
+
+	for _, test := range tests {
+		variant := testVariant(ProductSyncGw, EditionEnterprise, test.version, Archamd64, Archarm64)
+		got, err := syncGatewaySpec{}.PackageFile(variant, test.arch)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.version, test.arch, err)
+		} else if got != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.version, test.arch, got, test.want)
+		}
+	}
+}
+
+func TestSyncGatewayParams(t *testing.T) {
+	variant := testVariant(ProductSyncGw, EditionCommunity, "3.2.0", Archamd64, Archarm64)
+	variant.UbuntuVersion = "22.04"
+	checkParams(t, variant, map[string]any{
+		"SYNC_GATEWAY_PACKAGE_URL":      "https://packages.couchbase.com/releases/couchbase-sync-gateway/3.2.0/couchbase-sync-gateway-community_3.2.0_@@ARCH@@.deb",
+		"SYNC_GATEWAY_PACKAGE_FILENAME": "couchbase-sync-gateway-community_3.2.0_@@ARCH@@.deb",
+		"DOCKER_BASE_IMAGE":             "ubuntu:22.04",
+	})
+}
+
+// Customized package URLs and filenames use the same uname -m names for
+// @@ARCH@@ as the default ones
+func TestSyncGatewayCustomizedPackage(t *testing.T) {
+	variant := testVariant(ProductSyncGw, EditionEnterprise, "3.2.0-1234", Archamd64, Archarm64)
+	variant.gen.Customizations = VersionCustomizations{
+		"sync-gateway_enterprise_3.2.0-1234": {
+			PackageUrl:      "https://builds.example.com/sgw-3.2.0-1234_@@ARCH@@.deb",
+			PackageFilename: "sgw-3.2.0-1234_@@ARCH@@.deb",
+		},
+	}
+
+	packageURL, err := variant.packageURL(Archarm64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://builds.example.com/sgw-3.2.0-1234_aarch64.deb"; packageURL != want {
+		t.Errorf("package URL: got %s, want %s", packageURL, want)
+	}
+	packageFile, err := variant.packageFile(Archamd64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sgw-3.2.0-1234_x86_64.deb"; packageFile != want {
+		t.Errorf("package file: got %s, want %s", packageFile, want)
+	}
+	checkParams(t, variant, map[string]any{
+		"SYNC_GATEWAY_PACKAGE_URL":      "https://builds.example.com/sgw-3.2.0-1234_@@ARCH@@.deb",
+		"SYNC_GATEWAY_PACKAGE_FILENAME": "sgw-3.2.0-1234_@@ARCH@@.deb",
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ProductSpec describes everything the generator needs to know about a
+// single product. Each product implements it in its own product_*.go file
+// and registers it with registerProduct() from an init() function.
+//
+// Methods receive the fully resolved variant, ie. with the rules applied.
+// Version customizations are applied by the generator on top of what
+// the methods return, so they need not handle those.
+type ProductSpec interface {
+	// Product returns the name of the product, eg. "couchbase-server"
+	Product() Product
+	// Params returns the template parameters of the variant
+	Params(variant DockerfileVariant) (map[string]any, error)
+	// PackageFile returns the filename of the package installed for the
+	// given arch, or "" if the product doesn't install a package. For
+	// Archgeneric, the filename contains @@ARCH@@ instead.
+	PackageFile(variant DockerfileVariant, arch Arch) (string, error)
+	// ReleaseURL returns the URL of the directory packages are downloaded
+	// from
+	ReleaseURL(variant DockerfileVariant) string
+	// BaseImage returns the Docker image to build FROM, if the rules
+	// don't name one
+	BaseImage(variant DockerfileVariant) (string, error)
+	// Arches returns the architectures the product is built for, unless
+	// the rules say otherwise
+	Arches() []Arch
+	// Resources returns the subdirectories of generate/resources/PRODUCT
+	// which are mirrored into every generated directory
+	Resources() []string
+}
+
+// archNameSpec may be implemented by a ProductSpec whose package
+// filenames name architectures differently from Arch, eg. x86_64 rather
+// than amd64. @@ARCH@@ in customized package filenames and URLs is
+// replaced accordingly.
+type archNameSpec interface {
+	ArchName(arch Arch) string
+}
+
+// Registered products, by name
+var productSpecs = map[Product]ProductSpec{}
+
+// registerProduct makes the product known to the generator. Products are
+// processed in order of name.
+func registerProduct(spec ProductSpec) {
+	product := spec.Product()
+	if _, ok := productSpecs[product]; ok {
+		panic(fmt.Sprintf("product %s registered twice", product))
+	}
+	productSpecs[product] = spec
+
+	default_products = append(default_products, product)
+	sort.Slice(default_products, func(i, j int) bool {
+		return default_products[i] < default_products[j]
+	})
+}
+
+// spec returns the ProductSpec of the variant's product
+func (variant DockerfileVariant) spec() (ProductSpec, error) {
+	spec, ok := productSpecs[variant.Product]
+	if !ok {
+		return nil, fmt.Errorf("unknown product %v", variant.Product)
+	}
+	return spec, nil
+}
+
+// ubuntuBaseImage is the BaseImage() of products based on Ubuntu
+func ubuntuBaseImage(variant DockerfileVariant) (string, error) {
+	ubuntuVersion, err := variant.ubuntuVersion()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ubuntu:%s", ubuntuVersion), nil
+}
+
+// releasesURL is the ReleaseURL() of most products:
+// packages.couchbase.com/releases/SUBDIR/VERSION, or the staging
+// equivalent for staging variants
+func releasesURL(variant DockerfileVariant, subdir string) string {
+	host := "https://packages.couchbase.com"
+	if variant.IsStaging {
+		host = "http://" + stagingHost
+	}
+	if subdir == "" {
+		return fmt.Sprintf("%s/releases/%s", host, variant.Version)
+	}
+	return fmt.Sprintf("%s/releases/%s/%s", host, subdir, variant.Version)
+}
+
+// withSHA256Params adds the SHA256 parameters of the variant to params,
+// for products which verify the package they install
+func withSHA256Params(variant DockerfileVariant, params map[string]any) (map[string]any, error) {
+	sha256Params, err := variant.sha256Params()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range sha256Params {
+		params[key] = value
+	}
+	return params, nil
+}
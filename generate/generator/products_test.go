@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+// testVariant returns a variant of the product which its ProductSpec can
+// be called with directly, without a repository, rules or the network:
+// there are no customizations, and checksums are skipped
+func testVariant(product Product, edition Edition, version string, arches ...Arch) DockerfileVariant {
+	return DockerfileVariant{
+		Edition:       edition,
+		Product:       product,
+		Version:       version,
+		TargetVersion: version,
+		Arches:        arches,
+		UbuntuVersion: "24.04",
+		SkipChecksum:  true,
+		gen: &Generator{
+			Config:         &Config{},
+			Customizations: VersionCustomizations{},
+		},
+		log: log.New(io.Discard, "", 0),
+	}
+}
+
+// checkParams fails the test for every expected parameter which differs
+// from the one the spec returned
+func checkParams(t *testing.T, variant DockerfileVariant, want map[string]any) {
+	t.Helper()
+	spec, err := variant.spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := spec.Params(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, params[key], value)
+		}
+	}
+}
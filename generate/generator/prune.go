@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// extraMirroredFiles lists the files under the resource subdirectories
+// of the variant's target directory (which mirror those of
+// generate/resources/PRODUCT) which aren't among the rendered files,
+// ie. which regenerating the directory would delete. Paths are relative
+// to the target directory.
+func extraMirroredFiles(variant DockerfileVariant, files []renderedFile) ([]string, error) {
+	rendered := map[string]bool{}
+	for _, file := range files {
+		rendered[file.Path] = true
+	}
+
+	spec, err := variant.spec()
+	if err != nil {
+		return nil, err
+	}
+
+	extra := []string{}
+	for _, subdir := range spec.Resources() {
+		existing, err := listFiles(path.Join(variant.targetDir(), subdir))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range existing {
+			if file = path.Join(subdir, file); !rendered[file] {
+				extra = append(extra, file)
+			}
+		}
+	}
+	return extra, nil
+}
+
+// orphanedFiles lists the files in the variant's target directory which
+// come from no template or resource: anything other than the Dockerfile,
+// the generation metadata and settings, and files with the same path under
+// generate/resources/PRODUCT. Paths are relative to the target directory.
+func orphanedFiles(variant DockerfileVariant) ([]string, error) {
+	resourcesDir := path.Join(variant.gen.BaseDir, "generate", "resources", string(variant.Product))
+
+	existing, err := listFiles(variant.targetDir())
+	if err != nil {
+		return nil, err
+	}
+
+	orphaned := []string{}
+	for _, file := range existing {
+		if file == "Dockerfile" || file == metadataFile || file == settingsFile {
+			continue
+		}
+		fromResource, err := exists(path.Join(resourcesDir, file))
+		if err != nil {
+			return nil, err
+		}
+		if !fromResource {
+			orphaned = append(orphaned, file)
+		}
+	}
+	return orphaned, nil
+}
+
+// pruneVariant deletes the orphaned files of the variant, recording them
+// in its result. With --dry-run, they're only recorded.
+func pruneVariant(variant DockerfileVariant) error {
+	orphaned, err := orphanedFiles(variant)
+	if err != nil {
+		return err
+	}
+
+	// Files that a dry run already reported as deleted by regeneration
+	// needn't be reported twice
+	deleted := map[string]bool{}
+	for _, filename := range variant.result.DryRun.Deleted {
+		deleted[filename] = true
+	}
+
+	for _, file := range orphaned {
+		filename := path.Join(variant.targetDir(), file)
+		if deleted[filename] {
+			continue
+		}
+		if !variant.gen.DryRun {
+			if err := os.Remove(filename); err != nil {
+				return err
+			}
+		}
+		variant.result.Pruned = append(variant.result.Pruned, filename)
+	}
+	return nil
+}
+
+// listFiles returns the paths of all files under dir, relative to dir and
+// sorted. A missing dir has no files.
+func listFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filename == dir {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// staleBase is a version whose base image tag now resolves to a different
+// digest than the one recorded when its directory was generated, so that
+// it would pick up a new base image when rebuilt
+type staleBase struct {
+	Variant DockerfileVariant
+	Image   string
+	// The digest recorded in the directory's metadata, or "" if none was
+	// recorded for the image
+	OldDigest string
+	NewDigest string
+	// Everything the tag currently resolves to, for the lockfile
+	digests ImageDigests
+}
+
+// findStaleBases resolves the base image of every version directory
+// matched by the filter (other than those excluded from generation)
+// against its registry, bypassing the lockfile, and returns those whose
+// digest differs from the one recorded in their metadata when they were
+// generated, or which have no digest recorded at all.
+func (gen *Generator) findStaleBases(filter variantFilter) ([]staleBase, error) {
+	matching, err := gen.matchingVariants(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []staleBase{}
+	for _, variant := range matching {
+		if skipGeneration.Matches(variant.Product, variant.versionDirName()) {
+			continue
+		}
+		variant, err := variant.withSavedSettings()
+		if err != nil {
+			return nil, err
+		}
+		image, err := variant.unpinnedBaseImage()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", variant.targetDir(), err)
+		}
+		if strings.Contains(image, "@") {
+			// Pinned by a version customization, so never refreshed
+			continue
+		}
+
+		current, err := gen.resolveImage(image)
+		if err != nil {
+			return nil, err
+		}
+		newDigest, err := current.forArches(variant.Arches)
+		if err != nil {
+			return nil, fmt.Errorf("%s: base image %s: %v", variant.targetDir(), image, err)
+		}
+
+		metadata, err := variant.readMetadata()
+		if err != nil {
+			return nil, err
+		}
+		oldDigest := ""
+		if metadata != nil && metadata.BaseImage != nil && metadata.BaseImage.Image == image {
+			oldDigest = metadata.BaseImage.Digest
+		}
+		if oldDigest == newDigest {
+			continue
+		}
+
+		stale = append(stale, staleBase{
+			Variant:   variant,
+			Image:     image,
+			OldDigest: oldDigest,
+			NewDigest: newDigest,
+			digests:   current,
+		})
+	}
+	return stale, nil
+}
+
+// applyStaleBases regenerates the stale versions: those which pin digests
+// are pinned to the new digests, which are recorded in the lockfile, and
+// for the others only the digest recorded in the metadata changes, as
+// they already pick up the new base image when rebuilt. Other versions
+// pinning the same images aren't regenerated, so they keep their digests
+// and are still listed as stale until they are refreshed themselves.
+func (gen *Generator) applyStaleBases(stale []staleBase) []*variantResult {
+	variants := []DockerfileVariant{}
+	for _, s := range stale {
+		if s.Variant.PinDigests {
+			gen.BaseImageLock.Set(s.Image, s.digests)
+		}
+		variants = append(variants, s.Variant)
+	}
+
+	return gen.forEachVariant(variants, func(variant DockerfileVariant) error {
+		return generateVariant(variant, false)
+	})
+}
+
+// printStaleBases prints the versions found by findStaleBases, with the
+// old and new digests of their base images
+func printStaleBases(out io.Writer, stale []staleBase) {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "EDITION\tPRODUCT\tVERSION\tPINNED\tIMAGE\tOLD DIGEST\tNEW DIGEST")
+	for _, s := range stale {
+		v := s.Variant
+		oldDigest := s.OldDigest
+		if oldDigest == "" {
+			oldDigest = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n",
+			v.Edition, v.Product, v.versionDirName(), v.PinDigests, s.Image, oldDigest, s.NewDigest)
+	}
+	table.Flush()
+}
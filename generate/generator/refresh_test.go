@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRepo creates a repository with the templates, resources and rules
+// of this one, and empty directories for the given versions of Couchbase
+// Server Enterprise
+func newTestRepo(t *testing.T, versions ...string) string {
+	baseDir := t.TempDir()
+	for _, name := range []string{"templates", "resources"} {
+		if err := CopyDir(path.Join("..", name), path.Join(baseDir, "generate", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CopyFile(path.Join("..", rulesFile), path.Join(baseDir, "generate", rulesFile)); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range versions {
+		if err := os.MkdirAll(path.Join(baseDir, "enterprise", "couchbase-server", version), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return baseDir
+}
+
+// testDigest is the digest the test registry serves for the given
+// generation of every image
+func testDigest(generation int32) string {
+	return fmt.Sprintf("sha256:%064d", generation)
+}
+
+// refreshTest is a repository of Couchbase Server Enterprise versions,
+// and a registry serving every image as a single manifest whose digest
+// changes with each generation
+type refreshTest struct {
+	t          *testing.T
+	baseDir    string
+	registry   *httptest.Server
+	generation int32
+}
+
+func newRefreshTest(t *testing.T, versions ...string) *refreshTest {
+	test := &refreshTest{t: t, baseDir: newTestRepo(t, versions...), generation: 1}
+	test.registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v2/") || !strings.Contains(r.URL.Path, "/manifests/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest(atomic.LoadInt32(&test.generation)))
+		fmt.Fprint(w, `{"mediaType": "application/vnd.oci.image.manifest.v1+json"}`)
+	}))
+	t.Cleanup(test.registry.Close)
+	return test
+}
+
+// pin makes the version pin its base image, as if generated in single
+// mode with --pin-digests
+func (test *refreshTest) pin(version string) {
+	settings := []byte(`{"pin_digests": true}`)
+	if err := os.WriteFile(path.Join(test.baseDir, "enterprise", "couchbase-server", version, settingsFile), settings, 0644); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+// run returns a generator for a new run, and the filter for the given
+// versions
+func (test *refreshTest) run(versions string) (*Generator, variantFilter) {
+	gen, err := newGenerator(test.baseDir, "")
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	gen.Config.RegistryURLs = map[string]string{"docker.io": test.registry.URL}
+	gen.Config.AllowHTTPHosts = []string{"127.0.0.1"}
+	gen.SkipChecksum = optionalBool{Value: true, Set: true}
+	filter, err := newVariantFilter("enterprise", "couchbase-server", versions)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	return gen, filter
+}
+
+// generate generates the given versions in a new run, saving the locks
+// afterwards
+func (test *refreshTest) generate(versions string, count int) {
+	gen, filter := test.run(versions)
+	results, err := gen.generateAllDockerfiles(filter, false)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	checkResults(test.t, results, count)
+	if err := gen.saveLocks(); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+// stale returns the stale versions, by directory name, in a new run
+func (test *refreshTest) stale(versions string) map[string]staleBase {
+	gen, filter := test.run(versions)
+	stale, err := gen.findStaleBases(filter)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	byVersion := map[string]staleBase{}
+	for _, s := range stale {
+		byVersion[s.Variant.versionDirName()] = s
+	}
+	return byVersion
+}
+
+// apply refreshes the given versions in a new run, like refresh-bases
+// --apply
+func (test *refreshTest) apply(versions string, count int) {
+	gen, filter := test.run(versions)
+	stale, err := gen.findStaleBases(filter)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	checkResults(test.t, gen.applyStaleBases(stale), count)
+	if err := gen.saveLocks(); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+// checkFrom checks the FROM line of the version's Dockerfile, which must
+// name the base image followed by suffix
+func (test *refreshTest) checkFrom(version string, suffix string) {
+	test.t.Helper()
+	dockerfile, err := os.ReadFile(path.Join(test.baseDir, "enterprise", "couchbase-server", version, "Dockerfile"))
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(dockerfile), "\n") {
+		if strings.HasPrefix(line, "FROM ") {
+			if !strings.HasPrefix(line, "FROM ubuntu:") || !strings.HasSuffix(line, ":24.04"+suffix) {
+				test.t.Errorf("%s: got %s, want ubuntu:24.04%s", version, line, suffix)
+			}
+			return
+		}
+	}
+	test.t.Errorf("%s: no FROM line", version)
+}
+
+func TestRefreshBases(t *testing.T) {
+	// All of these are based on ubuntu:24.04
+	test := newRefreshTest(t, "7.6.2", "8.0.0", "8.0.1", "8.0.2")
+	test.pin("7.6.2")
+	test.pin("8.0.2")
+
+	// Every generated version, pinned or not, records the digest, so
+	// nothing is stale until the tag moves on
+	test.generate(">= 7.6.2, < 8.0.0", 1)
+	test.generate(">= 8.0.1", 2)
+	if stale := test.stale(""); len(stale) != 1 || stale["8.0.0"].OldDigest != "" {
+		t.Fatalf("got %+v, want only 8.0.0 without a digest", stale)
+	}
+
+	// A version generated after the tag moved records the new digest
+	atomic.StoreInt32(&test.generation, 2)
+	test.generate("= 8.0.0", 1)
+	stale := test.stale("")
+	if len(stale) != 3 {
+		t.Fatalf("%d stale version(s), want 3", len(stale))
+	}
+	for _, version := range []string{"7.6.2", "8.0.1", "8.0.2"} {
+		if s := stale[version]; s.OldDigest != testDigest(1) || s.NewDigest != testDigest(2) {
+			t.Errorf("%s: old digest %q, new digest %q", version, s.OldDigest, s.NewDigest)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	gen, filter := test.run("")
+	list, err := gen.findStaleBases(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printStaleBases(out, list)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[2], "8.0.1") || !strings.Contains(lines[2], "false") ||
+		!strings.Contains(lines[3], "8.0.2") || !strings.Contains(lines[3], "true") {
+		t.Errorf("unexpected report:\n%s", out)
+	}
+
+	// Refreshing one version leaves the others stale, including the one
+	// pinning the same tag
+	test.apply("= 8.0.2", 1)
+	test.checkFrom("8.0.2", "@"+testDigest(2))
+	test.checkFrom("7.6.2", "@"+testDigest(1))
+	if stale := test.stale(""); len(stale) != 2 || stale["7.6.2"].OldDigest != testDigest(1) || stale["8.0.1"].OldDigest != testDigest(1) {
+		t.Errorf("got %+v, want 7.6.2 and 8.0.1 still stale", stale)
+	}
+
+	// Refreshing a version which doesn't pin its base image only records
+	// the new digest
+	test.apply("", 2)
+	test.checkFrom("7.6.2", "@"+testDigest(2))
+	test.checkFrom("8.0.1", "")
+	if stale := test.stale(""); len(stale) != 0 {
+		t.Errorf("%d stale version(s) after applying", len(stale))
+	}
+}
+
+// checkResults fails the test unless there are the given number of
+// results, all of which succeeded
+func checkResults(t *testing.T, results []*variantResult, count int) {
+	t.Helper()
+	if len(results) != count {
+		t.Fatalf("%d result(s), want %d", len(results), count)
+	}
+	for _, result := range results {
+		if result.Status != statusSucceeded {
+			t.Fatalf("%s %s: %v", result.Variant.targetDir(), result.Status, result.Err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Manifest media types accepted from registries, most preferred first
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// RegistryError is returned when a base image can't be resolved to a
+// digest through the Docker Registry HTTP API v2
+type RegistryError struct {
+	Image string
+	URL   string
+	// HTTP status code of the response, or 0 if there was no response
+	StatusCode int
+	Err        error
+}
+
+func (e *RegistryError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("failed to resolve %s from %s: HTTP status %d", e.Image, e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("failed to resolve %s from %s: %v", e.Image, e.URL, e.Err)
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+var registryClient = &http.Client{Timeout: 60 * time.Second}
+
+// Matches a key="value" parameter of an authentication challenge
+var challengeParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// imageReference is a base image split into the parts the registry API
+// needs, eg. docker.io, library/ubuntu and 24.04 for ubuntu:24.04
+type imageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// parseImageReference splits an image name with an optional tag (but no
+// digest) into its registry, repository and tag
+func parseImageReference(image string) (imageReference, error) {
+	if strings.Contains(image, "@") {
+		return imageReference{}, fmt.Errorf("image %s is already pinned", image)
+	}
+
+	registry, name := splitImageRegistry(image)
+	ref := imageReference{Registry: registry, Repository: name, Tag: "latest"}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Repository, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Repository == "" || ref.Tag == "" {
+		return imageReference{}, fmt.Errorf("malformed image %s", image)
+	}
+	if registry == "docker.io" && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	return ref, nil
+}
+
+// registryURL returns the base URL of the registry API for the given
+// registry, eg. https://registry-1.docker.io for docker.io
+func (config *Config) registryURL(registry string) string {
+	if u, ok := config.RegistryURLs[registry]; ok {
+		return strings.TrimSuffix(u, "/")
+	}
+	if registry == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + registry
+}
+
+// resolveImage looks up the digests the given image tag currently
+// resolves to in its registry
+func (config *Config) resolveImage(image string) (ImageDigests, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return ImageDigests{}, err
+	}
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", config.registryURL(ref.Registry), ref.Repository, ref.Tag)
+	if err := config.checkURL(manifestURL); err != nil {
+		return ImageDigests{}, err
+	}
+
+	body, digest, err := config.fetchManifest(manifestURL)
+	if err != nil {
+		if registryErr, ok := err.(*RegistryError); ok {
+			registryErr.Image = image
+		}
+		return ImageDigests{}, err
+	}
+
+	var manifest struct {
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return ImageDigests{}, &RegistryError{Image: image, URL: manifestURL, Err: err}
+	}
+
+	digests := ImageDigests{Index: digest}
+	for _, m := range manifest.Manifests {
+		arch := Arch(m.Platform.Architecture)
+		if m.Platform.OS != "linux" || (arch != Archamd64 && arch != Archarm64) {
+			continue
+		}
+		if digests.Platforms == nil {
+			digests.Platforms = map[Arch]string{}
+		}
+		digests.Platforms[arch] = m.Digest
+	}
+	return digests, nil
+}
+
+// fetchManifest downloads a manifest, authenticating with a bearer token
+// if the registry asks for one, and returns it along with its digest
+func (config *Config) fetchManifest(manifestURL string) ([]byte, string, error) {
+	resp, err := getManifest(manifestURL, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := config.fetchToken(challenge)
+		if err != nil {
+			return nil, "", &RegistryError{URL: manifestURL, Err: err}
+		}
+		if resp, err = getManifest(manifestURL, token); err != nil {
+			return nil, "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &RegistryError{URL: manifestURL, StatusCode: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", &RegistryError{URL: manifestURL, Err: err}
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	return body, digest, nil
+}
+
+func getManifest(manifestURL string, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, &RegistryError{URL: manifestURL, Err: err}
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return nil, &RegistryError{URL: manifestURL, Err: err}
+	}
+	return resp, nil
+}
+
+// fetchToken gets an anonymous bearer token as described by a
+// WWW-Authenticate challenge such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"
+func (config *Config) fetchToken(challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+	}
+
+	values := url.Values{}
+	realm := ""
+	for _, param := range challengeParamPattern.FindAllStringSubmatch(params, -1) {
+		if key, value := param[1], param[2]; key == "realm" {
+			realm = value
+		} else {
+			values.Set(key, value)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("no realm in authentication challenge '%s'", challenge)
+	}
+	if err := config.checkURL(realm); err != nil {
+		return "", err
+	}
+
+	resp, err := registryClient.Get(realm + "?" + values.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to %s failed with HTTP status %d", realm, resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
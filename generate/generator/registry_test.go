@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testIndex = `{
+  "mediaType": "application/vnd.oci.image.index.v1+json",
+  "manifests": [
+    {"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}},
+    {"digest": "sha256:arm64", "platform": {"os": "linux", "architecture": "arm64"}},
+    {"digest": "sha256:s390x", "platform": {"os": "linux", "architecture": "s390x"}},
+    {"digest": "sha256:windows", "platform": {"os": "windows", "architecture": "amd64"}}
+  ]
+}`
+
+const testManifest = `{
+  "mediaType": "application/vnd.oci.image.manifest.v1+json",
+  "config": {"digest": "sha256:config"}
+}`
+
+// newTestRegistry starts a registry serving ubuntu:24.04 as an image index
+// which requires a bearer token, and couchbase/single:1.0 as a single
+// manifest without a Docker-Content-Digest header. It returns a config
+// resolving images from docker.io against it, and the number of tokens
+// handed out.
+func newTestRegistry(t *testing.T) (*Config, *int) {
+	tokens := 0
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:library/ubuntu:pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		tokens++
+		fmt.Fprint(w, `{"token": "secret"}`)
+	})
+	mux.HandleFunc("/v2/library/ubuntu/manifests/24.04", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry.test",scope="repository:library/ubuntu:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:index")
+		fmt.Fprint(w, testIndex)
+	})
+	mux.HandleFunc("/v2/couchbase/single/manifests/1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testManifest)
+	})
+
+	config := &Config{
+		RegistryURLs:   map[string]string{"docker.io": srv.URL},
+		AllowHTTPHosts: []string{"127.0.0.1"},
+	}
+	return config, &tokens
+}
+
+func TestResolveImageIndex(t *testing.T) {
+	config, tokens := newTestRegistry(t)
+
+	digests, err := config.resolveImage("ubuntu:24.04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ImageDigests{
+		Index:     "sha256:index",
+		Platforms: map[Arch]string{Archamd64: "sha256:amd64", Archarm64: "sha256:arm64"},
+	}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("got %+v, want %+v", digests, want)
+	}
+	if *tokens != 1 {
+		t.Errorf("%d tokens requested, want 1", *tokens)
+	}
+}
+
+func TestResolveImageSingleManifest(t *testing.T) {
+	config, tokens := newTestRegistry(t)
+
+	digests, err := config.resolveImage("couchbase/single:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ImageDigests{Index: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(testManifest)))}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("got %+v, want %+v", digests, want)
+	}
+	if *tokens != 0 {
+		t.Errorf("%d tokens requested, want 0", *tokens)
+	}
+}
+
+func TestResolveImageNotFound(t *testing.T) {
+	config, _ := newTestRegistry(t)
+
+	_, err := config.resolveImage("ubuntu:99.04")
+	var registryErr *RegistryError
+	if !errors.As(err, &registryErr) {
+		t.Fatalf("expected a RegistryError, got %v", err)
+	}
+	if registryErr.StatusCode != http.StatusNotFound || registryErr.Image != "ubuntu:99.04" {
+		t.Errorf("got %+v", registryErr)
+	}
+}
+
+func TestResolveImageRequiresHTTPS(t *testing.T) {
+	config, _ := newTestRegistry(t)
+	config.AllowHTTPHosts = nil
+
+	if digests, err := config.resolveImage("ubuntu:24.04"); err == nil {
+		t.Errorf("expected an error, got %+v", digests)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// renderedFile is a single file of a generated variant, rendered in
+// memory rather than written to the target directory
+type renderedFile struct {
+	// Path relative to the variant's target directory
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+}
+
+// renderVariant renders the files generateVariant() would write for the
+// variant from the templates and resources - the Dockerfile, resource
+// subdirectories, README and, in single mode, settings file - without
+// touching the target directory. The metadata, which may need the
+// network, is rendered separately by renderMetadata().
+func renderVariant(variant DockerfileVariant) ([]renderedFile, error) {
+	dockerfile, err := renderDockerfile(variant)
+	if err != nil {
+		return nil, err
+	}
+	files := []renderedFile{{Path: "Dockerfile", Content: dockerfile, Mode: 0644}}
+
+	resources, err := renderResources(variant)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, resources...)
+
+	if variant.saveSettings {
+		settings, ok, err := variant.renderSettings()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			files = append(files, settings)
+		}
+	}
+
+	return files, nil
+}
+
+// renderResources renders the resource subdirectories and README of the
+// variant, ie. everything other than the Dockerfile
+func renderResources(variant DockerfileVariant) ([]renderedFile, error) {
+	spec, err := variant.spec()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []renderedFile{}
+	for _, subdir := range spec.Resources() {
+		resources, err := renderResourcesSubdir(variant, subdir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, resources...)
+	}
+
+	readme, err := renderReadme(variant)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, readme), nil
+}
+
+func renderReadme(variant DockerfileVariant) (renderedFile, error) {
+	return renderResourceFile(
+		path.Join(variant.gen.BaseDir, "generate", "resources", string(variant.Product), "README.md"),
+		"README.md",
+	)
+}
+
+// renderResourcesSubdir is the in-memory equivalent of deployResourcesSubdir()
+func renderResourcesSubdir(variant DockerfileVariant, subdir string) ([]renderedFile, error) {
+	srcDir := path.Join(
+		variant.gen.BaseDir,
+		"generate",
+		"resources",
+		string(variant.Product),
+		subdir,
+	)
+
+	exists, err := exists(srcDir)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	files := []renderedFile{}
+	err = filepath.WalkDir(srcDir, func(srcFile string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, srcFile)
+		if err != nil {
+			return err
+		}
+		file, err := renderResourceFile(srcFile, path.Join(subdir, filepath.ToSlash(rel)))
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+func renderResourceFile(srcFile string, targetPath string) (renderedFile, error) {
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		return renderedFile{}, err
+	}
+	content, err := os.ReadFile(srcFile)
+	if err != nil {
+		return renderedFile{}, err
+	}
+	return renderedFile{Path: targetPath, Content: content, Mode: info.Mode().Perm()}, nil
+}
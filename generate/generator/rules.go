@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Name of the file (relative to the "generate" directory) holding the
+// rules which determine the attributes of every variant
+const rulesFile = "rules.json"
+
+// Rules decide the attributes of each variant - its architectures,
+// template, base image and so on - from its product, edition and version.
+// Every rule which matches a variant is applied in order, so later rules
+// override earlier ones.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// A Rule sets some attributes of every variant matched by its selectors.
+// Selectors left empty match everything.
+type Rule struct {
+	// Free-form explanation of the rule, for humans
+	Description string `json:"description"`
+
+	Products []Product `json:"products"`
+	Editions []Edition `json:"editions"`
+	// A version constraint, eg. ">= 7.1.0, < 8.0". This is checked
+	// against the version without any suffix, so eg. 7.0.0-beta is
+	// treated as 7.0.0.
+	Versions string `json:"versions"`
+	// A regular expression matched against the full version, including
+	// any suffix
+	VersionPattern string `json:"version_pattern"`
+
+	Set RuleAttributes `json:"set"`
+
+	// eg. "rule 3 (Defaults for every product)", for messages
+	name        string
+	constraints Constraints
+	pattern     *regexp.Regexp
+}
+
+// RuleAttributes are the attributes of a variant a rule may set. Only
+// attributes which are present are changed.
+type RuleAttributes struct {
+	// The real version of the product, where it differs from the version
+	// of the image (eg. 7.0.3-MP1 for 7.0.3)
+	Version string `json:"version"`
+	// Architectures the image is built for
+	Arches []Arch `json:"arches"`
+	// Template filename under generate/templates/PRODUCT
+	Template string `json:"template"`
+	// Docker image to build FROM, if not ubuntu:UBUNTU_VERSION. Any
+	// @@VERSION@@ is replaced with the version of the product.
+	BaseImage *string `json:"base_image"`
+	// Ubuntu version of the base image and packages
+	UbuntuVersion string `json:"ubuntu_version"`
+	// Extra packages to install (Couchbase Server only)
+	ExtraDeps *string `json:"extra_deps"`
+	// Whether the image needs the systemd workaround (Couchbase Server only)
+	SystemdWorkaround *bool `json:"systemd_workaround"`
+}
+
+// loadRules reads the rules from generate/rules.json under the given
+// base directory
+func loadRules(baseDir string) (*Rules, error) {
+	filename := path.Join(baseDir, "generate", rulesFile)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{}
+	if err := newStrictDecoder(data).Decode(rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return rules, nil
+}
+
+// compile parses the selectors of every rule, and validates the rules,
+// reporting all problems at once
+func (rules *Rules) compile() error {
+	problems := []string{}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		rule.name = fmt.Sprintf("rule %d", i+1)
+		if rule.Description != "" {
+			rule.name = fmt.Sprintf("rule %d (%s)", i+1, rule.Description)
+		}
+		name := rule.name
+
+		for _, product := range rule.Products {
+			if !isKnownProduct(product) {
+				problems = append(problems, fmt.Sprintf("unknown product '%s' in %s", product, name))
+			}
+		}
+		for _, edition := range rule.Editions {
+			if !isKnownEdition(edition) {
+				problems = append(problems, fmt.Sprintf("unknown edition '%s' in %s", edition, name))
+			}
+		}
+		for _, arch := range rule.Set.Arches {
+			if !isKnownArch(arch) || arch == Archgeneric {
+				problems = append(problems, fmt.Sprintf("unknown arch '%s' in %s", arch, name))
+			}
+		}
+
+		if rule.Versions != "" {
+			constraints, err := parseConstraints(rule.Versions)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("bad versions '%s' in %s: %v", rule.Versions, name, err))
+			}
+			rule.constraints = constraints
+		}
+		if rule.Set.Version != "" {
+			if _, err := parseVersion(rule.Set.Version); err != nil {
+				problems = append(problems, fmt.Sprintf("bad version '%s' in %s: %v", rule.Set.Version, name, err))
+			}
+		}
+		if rule.VersionPattern != "" {
+			pattern, err := regexp.Compile(rule.VersionPattern)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("bad version_pattern '%s' in %s: %v", rule.VersionPattern, name, err))
+			}
+			rule.pattern = pattern
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid rules:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// matches returns true if all selectors of the rule match the given
+// product, edition and version
+func (rule Rule) matches(product Product, edition Edition, ver Version) bool {
+	if len(rule.Products) > 0 && !containsProduct(rule.Products, product) {
+		return false
+	}
+	if len(rule.Editions) > 0 && !containsEdition(rule.Editions, edition) {
+		return false
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(ver.String()) {
+		return false
+	}
+	// eg. 7.0.0-beta => 7.0.0
+	if rule.constraints != nil && !rule.constraints.Check(ver.Core()) {
+		return false
+	}
+	return true
+}
+
+// apply sets the attributes of the variant from every matching rule,
+// selecting on the variant's product, edition and target version
+func (rules *Rules) apply(variant *DockerfileVariant) error {
+	targetVersion, err := parseVersion(variant.TargetVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules.Rules {
+		if !rule.matches(variant.Product, variant.Edition, targetVersion) {
+			continue
+		}
+
+		set := rule.Set
+		source := rule.String()
+		if set.Version != "" {
+			variant.Version = set.Version
+			variant.setBy("Version", source)
+		}
+		if len(set.Arches) > 0 {
+			variant.Arches = set.Arches
+			variant.setBy("Arches", source)
+		}
+		if set.Template != "" {
+			variant.TemplateFilename = set.Template
+			variant.setBy("TemplateFilename", source)
+		}
+		if set.BaseImage != nil {
+			variant.BaseImage = *set.BaseImage
+			variant.setBy("BaseImage", source)
+		}
+		if set.UbuntuVersion != "" {
+			variant.UbuntuVersion = set.UbuntuVersion
+			variant.setBy("UbuntuVersion", source)
+		}
+		if set.ExtraDeps != nil {
+			variant.ExtraDeps = *set.ExtraDeps
+			variant.setBy("ExtraDeps", source)
+		}
+		if set.SystemdWorkaround != nil {
+			variant.SystemdWorkaround = *set.SystemdWorkaround
+			variant.setBy("SystemdWorkaround", source)
+		}
+	}
+	return nil
+}
+
+// String describes the rule along with its selectors, eg.
+// rule 12 (7.1.0 and higher also support arm64) of rules.json [versions >= 7.1.0]
+func (rule Rule) String() string {
+	selectors := []string{}
+	if len(rule.Products) > 0 {
+		products := []string{}
+		for _, product := range rule.Products {
+			products = append(products, string(product))
+		}
+		selectors = append(selectors, "products "+strings.Join(products, ","))
+	}
+	if len(rule.Editions) > 0 {
+		editions := []string{}
+		for _, edition := range rule.Editions {
+			editions = append(editions, string(edition))
+		}
+		selectors = append(selectors, "editions "+strings.Join(editions, ","))
+	}
+	if rule.Versions != "" {
+		selectors = append(selectors, "versions "+rule.Versions)
+	}
+	if rule.VersionPattern != "" {
+		selectors = append(selectors, "version_pattern "+rule.VersionPattern)
+	}
+	if len(selectors) == 0 {
+		return fmt.Sprintf("%s of %s", rule.name, rulesFile)
+	}
+	return fmt.Sprintf("%s of %s [%s]", rule.name, rulesFile, strings.Join(selectors, "; "))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// baselineVariant holds the attributes of a version as the generator
+// computed them with if-chains in Go, before they moved into rules.json
+type baselineVariant struct {
+	Version           string
+	Template          string
+	Arches            []Arch
+	BaseImage         string
+	ExtraDeps         string
+	SystemdWorkaround bool
+}
+
+// baselineIntVer is the generator's former comparison key for versions,
+// eg. 70100 for 7.1.0 and 71000 for 7.10.0; anything after a "-" is
+// ignored
+func baselineIntVer(v string) int64 {
+	sections := strings.Split(strings.Split(v, "-")[0], ".")
+	s := ""
+	for i := 0; i < 3; i++ {
+		s += fmt.Sprintf("%02s", sections[i])
+	}
+	ver, _ := strconv.ParseInt(s, 10, 64)
+	return ver
+}
+
+func baselineServerUbuntuVersion(ver int64) string {
+	switch {
+	case ver >= 40000 && ver < 50000:
+		return "14.04"
+	case ver >= 50000 && ver <= 60000:
+		return "16.04"
+	case ver >= 60001 && ver <= 60601:
+		return "18.04"
+	case ver >= 60602 && ver <= 70106:
+		return "20.04"
+	case ver >= 70200 && ver <= 70205, ver >= 70600 && ver <= 70601:
+		return "22.04"
+	}
+	return "24.04"
+}
+
+// newBaselineVariant reproduces the special cases of the former
+// generator, other than version customizations
+func newBaselineVariant(product Product, dirVersion string) baselineVariant {
+	variant := baselineVariant{
+		Version:  strings.TrimSuffix(dirVersion, "-staging"),
+		Template: "Dockerfile.template",
+		Arches:   []Arch{Archamd64},
+	}
+	ver := baselineIntVer(variant.Version)
+
+	switch product {
+	case ProductServer:
+		variant.BaseImage = "ubuntu:" + baselineServerUbuntuVersion(ver)
+		if ver == 70003 {
+			variant.Version = "7.0.3-MP1"
+		}
+		if ver >= 70100 {
+			variant.Arches = append(variant.Arches, Archarm64)
+		}
+		variant.ExtraDeps = "python-httplib2"
+		if ver >= 60500 {
+			variant.ExtraDeps = "bzip2"
+		}
+		variant.SystemdWorkaround = ver < 70000
+	case ProductSyncGw:
+		if ver <= 30003 {
+			variant.Template = "Dockerfile.centos.template"
+			variant.BaseImage = "centos:centos7"
+		} else {
+			variant.Template = "Dockerfile.ubuntu.template"
+			variant.Arches = append(variant.Arches, Archarm64)
+			variant.BaseImage = "ubuntu:22.04"
+		}
+		if strings.Contains(variant.Version, "forestdb") {
+			variant.BaseImage = "tleyden5iwx/forestdb"
+		}
+	case ProductSandbox:
+		if ver >= 71000 {
+			variant.Arches = append(variant.Arches, Archarm64)
+		}
+		variant.BaseImage = "couchbase/server:" + variant.Version
+	case ProductColumnar:
+		variant.Arches = append(variant.Arches, Archarm64)
+		variant.BaseImage = "ubuntu:22.04"
+	case ProductEnterpriseAnalytics, ProductEdgeServer:
+		variant.Arches = append(variant.Arches, Archarm64)
+		variant.BaseImage = "ubuntu:24.04"
+	}
+	return variant
+}
+
+// TestRulesMatchBaseline checks that rules.json reproduces what the
+// generator computed before it, for every version directory in the
+// repository
+func TestRulesMatchBaseline(t *testing.T) {
+	gen, err := newGenerator("../..", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the rules are compared
+	gen.Customizations = VersionCustomizations{}
+
+	dirs := gen.allVersionDirs()
+	if len(dirs) == 0 {
+		t.Fatal("no version directories found")
+	}
+	for _, dir := range dirs {
+		variant, err := gen.newVariant(dir.Edition, dir.Product, dir.Version, "", nil)
+		if err != nil {
+			t.Errorf("%s/%s/%s: %v", dir.Edition, dir.Product, dir.Version, err)
+			continue
+		}
+		baseImage, err := variant.unpinnedBaseImage()
+		if err != nil {
+			t.Errorf("%s: %v", variant.targetDir(), err)
+			continue
+		}
+		got := baselineVariant{
+			Version:           variant.Version,
+			Template:          variant.TemplateFilename,
+			Arches:            variant.Arches,
+			BaseImage:         baseImage,
+			ExtraDeps:         variant.ExtraDeps,
+			SystemdWorkaround: variant.SystemdWorkaround,
+		}
+		if want := newBaselineVariant(dir.Product, dir.Version); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s/%s/%s:\n got %+v\nwant %+v", dir.Edition, dir.Product, dir.Version, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Name of the file written into a generated directory which was generated
+// with custom settings, so that bulk generation can reproduce it
+const settingsFile = ".generate-settings.json"
+
+// optionalBool is a boolean setting which may be given on the command line
+// either way, or left out so that a saved setting applies
+type optionalBool struct {
+	Value bool
+	Set   bool
+}
+
+// newOptionalBool combines an option and its negated form, eg.
+// --skip-checksum and --no-skip-checksum, which the usage makes mutually
+// exclusive
+func newOptionalBool(option bool, negated bool) optionalBool {
+	return optionalBool{Value: option, Set: option || negated}
+}
+
+// flag returns the command line option which gave the setting
+func (b optionalBool) flag(name string) string {
+	if b.Value {
+		return "--" + name
+	}
+	return "--no-" + name
+}
+
+// generationSettings records the settings a directory was generated with
+// beyond the defaults. Only single mode writes them; bulk mode and "check"
+// read them back, so that regenerating the directory produces the same
+// output.
+type generationSettings struct {
+	// Template parameters given with -t or --overrides-file
+	Overrides map[string]any `json:"overrides,omitempty"`
+	// Whether the Dockerfile skips verifying the package SHA256
+	SkipChecksum bool `json:"skip_checksum,omitempty"`
+	// Whether the base image is pinned to a digest
+	PinDigests bool `json:"pin_digests,omitempty"`
+}
+
+func (settings generationSettings) isEmpty() bool {
+	return len(settings.Overrides) == 0 && !settings.SkipChecksum && !settings.PinDigests
+}
+
+// settings returns the custom settings of the variant
+func (variant DockerfileVariant) settings() generationSettings {
+	return generationSettings{
+		Overrides:    variant.TemplateOverrides,
+		SkipChecksum: variant.SkipChecksum,
+		PinDigests:   variant.PinDigests,
+	}
+}
+
+func (variant DockerfileVariant) settingsFilename() string {
+	return path.Join(variant.targetDir(), settingsFile)
+}
+
+// withSavedSettings returns the variant with the settings saved in its
+// target directory, if any, applied. Settings given on the command line
+// take precedence over saved ones, including eg. --no-skip-checksum over
+// a saved skip_checksum.
+func (variant DockerfileVariant) withSavedSettings() (DockerfileVariant, error) {
+	data, err := os.ReadFile(variant.settingsFilename())
+	if os.IsNotExist(err) {
+		return variant, nil
+	} else if err != nil {
+		return variant, err
+	}
+
+	decoder := newStrictDecoder(data)
+	decoder.UseNumber()
+	saved := generationSettings{}
+	if err := decoder.Decode(&saved); err != nil {
+		return variant, fmt.Errorf("%s: %v", variant.settingsFilename(), err)
+	}
+
+	overrides := map[string]any{}
+	for key, value := range saved.Overrides {
+		overrides[key] = normalizeJSONNumbers(value)
+		if _, ok := variant.TemplateOverrides[key]; !ok {
+			variant.setBy("params."+key, settingsFile)
+		}
+	}
+	for key, value := range variant.TemplateOverrides {
+		overrides[key] = value
+	}
+	variant.TemplateOverrides = overrides
+	if saved.SkipChecksum && !variant.gen.SkipChecksum.Set {
+		variant.SkipChecksum = true
+		variant.setBy("SkipChecksum", settingsFile)
+	}
+	if saved.PinDigests && !variant.gen.PinDigests.Set {
+		variant.PinDigests = true
+		variant.setBy("PinDigests", settingsFile)
+	}
+
+	return variant, nil
+}
+
+// renderSettings renders the settings file of the variant, which only
+// exists if it has any custom settings
+func (variant DockerfileVariant) renderSettings() (renderedFile, bool, error) {
+	settings := variant.settings()
+	if settings.isEmpty() {
+		return renderedFile{}, false, nil
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return renderedFile{}, false, err
+	}
+	return renderedFile{Path: settingsFile, Content: append(data, '\n'), Mode: 0644}, true, nil
+}
+
+// writeSettings writes the settings file of the variant, or removes any
+// existing one if the variant has no custom settings
+func (variant DockerfileVariant) writeSettings() error {
+	file, ok, err := variant.renderSettings()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := os.Remove(variant.settingsFilename()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(variant.settingsFilename(), file.Content, file.Mode)
+}
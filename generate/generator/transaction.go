@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dirTransaction stages changes to a directory in a temporary sibling
+// directory, which replaces the original only once all changes have been
+// made. If anything fails along the way, the original directory is left
+// exactly as it was.
+type dirTransaction struct {
+	// Directory being changed
+	target string
+	// Temporary copy of target that changes are made to
+	staging string
+}
+
+// beginDirTransaction creates the staging directory next to target (so
+// that it can later be renamed into place) and copies the current
+// contents of target, if any, into it. The target is made absolute first,
+// so that eg. "." is staged next to the current directory rather than in
+// it.
+func beginDirTransaction(target string) (*dirTransaction, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	parent, name := filepath.Split(target)
+	if name == "" {
+		return nil, fmt.Errorf("can't generate into %s", target)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(parent, fmt.Sprintf(".%s.tmp-", name))
+	if err != nil {
+		return nil, err
+	}
+	tx := &dirTransaction{target: target, staging: staging}
+	if isWithin(staging, target) {
+		// Copying target into it would never end
+		tx.Rollback()
+		return nil, fmt.Errorf("staging directory %s is inside %s", staging, target)
+	}
+
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(target); err == nil {
+		if !info.IsDir() {
+			tx.Rollback()
+			return nil, fmt.Errorf("%s is not a directory", target)
+		}
+		mode = info.Mode().Perm()
+		if err := CopyDir(target, staging); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// MkdirTemp always creates the directory with mode 0700
+	if err := os.Chmod(staging, mode); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Commit swaps the staging directory into place. The original directory
+// is moved aside first, and moved back should the swap fail.
+func (tx *dirTransaction) Commit() error {
+	backup := tx.staging + ".old"
+
+	// If the current directory is the target, or inside it, it moves
+	// aside with it; it's entered again by name once the swap is done
+	cwd, _ := os.Getwd()
+
+	hasTarget, err := exists(tx.target)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if hasTarget {
+		if err := os.Rename(tx.target, backup); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := os.Rename(tx.staging, tx.target); err != nil {
+		if hasTarget {
+			if restoreErr := os.Rename(backup, tx.target); restoreErr != nil {
+				return fmt.Errorf("%v (and failed to restore %s from %s: %v)",
+					err, tx.target, backup, restoreErr)
+			}
+		}
+		tx.Rollback()
+		return err
+	}
+
+	if cwd != "" && isWithin(cwd, tx.target) {
+		if err := os.Chdir(cwd); err != nil {
+			return err
+		}
+	}
+	if hasTarget {
+		return os.RemoveAll(backup)
+	}
+	return nil
+}
+
+// isWithin returns true if file is dir or anything below it. Both must be
+// absolute and clean.
+func isWithin(file string, dir string) bool {
+	return file == dir || strings.HasPrefix(file, dir+string(filepath.Separator))
+}
+
+// Rollback discards the staging directory, leaving the target untouched
+func (tx *dirTransaction) Rollback() {
+	os.RemoveAll(tx.staging)
+}
+
+// writeFileAtomic replaces filename with data by writing to a temporary
+// file in the same directory and renaming it into place, so that readers
+// never see a partially written file
+func writeFileAtomic(filename string, data []byte, mode os.FileMode) error {
+	dir, name := path.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, fmt.Sprintf(".%s.tmp-", name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
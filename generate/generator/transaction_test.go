@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// readDirFiles returns the contents of every file in dir, by name, or nil
+// if dir is empty or doesn't exist
+func readDirFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	var files map[string]string
+	for _, entry := range entries {
+		data, err := os.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files == nil {
+			files = map[string]string{}
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestDirTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// Files in the target before the transaction, nil if it doesn't
+		// exist
+		before map[string]string
+		commit bool
+		want   map[string]string
+	}{
+		{
+			name:   "commit replaces existing directory",
+			before: map[string]string{"Dockerfile": "old", "scripts": "kept"},
+			commit: true,
+			want:   map[string]string{"Dockerfile": "new", "scripts": "kept", "README.md": "added"},
+		},
+		{
+			name:   "commit creates directory",
+			commit: true,
+			want:   map[string]string{"Dockerfile": "new", "README.md": "added"},
+		},
+		{
+			name:   "rollback keeps existing directory",
+			before: map[string]string{"Dockerfile": "old", "scripts": "kept"},
+			want:   map[string]string{"Dockerfile": "old", "scripts": "kept"},
+		},
+		{
+			name: "rollback leaves no directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := t.TempDir()
+			target := path.Join(parent, "7.6.2")
+			if test.before != nil {
+				if err := os.Mkdir(target, 0755); err != nil {
+					t.Fatal(err)
+				}
+				for name, data := range test.before {
+					if err := os.WriteFile(path.Join(target, name), []byte(data), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			tx, err := beginDirTransaction(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readDirFiles(t, tx.staging); !reflect.DeepEqual(got, test.before) {
+				t.Errorf("staged %v, want a copy of %v", got, test.before)
+			}
+			for name, data := range map[string]string{"Dockerfile": "new", "README.md": "added"} {
+				if err := os.WriteFile(path.Join(tx.staging, name), []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Nothing shows in the target until the commit
+			if got := readDirFiles(t, target); !reflect.DeepEqual(got, test.before) {
+				t.Errorf("target changed before commit: %v", got)
+			}
+
+			if test.commit {
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				tx.Rollback()
+			}
+
+			if got := readDirFiles(t, target); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			var names []string
+			entries, _ := os.ReadDir(parent)
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			var wantNames []string
+			if test.want != nil {
+				wantNames = []string{"7.6.2"}
+			}
+			if !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("left %v next to the target, want %v", names, wantNames)
+			}
+		})
+	}
+}
+
+func TestBeginDirTransactionNotADirectory(t *testing.T) {
+	target := path.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(target, []byte("FROM ubuntu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := beginDirTransaction(target); err == nil {
+		t.Fatal("expected an error")
+	}
+	entries, _ := os.ReadDir(path.Dir(target))
+	if len(entries) != 1 {
+		t.Errorf("%d files left, want only the original", len(entries))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// Host serving staging packages. It isn't known to serve https, so it is
+// always allowed over plain http, and audit-urls reports its URLs as
+// allowed rather than insecure.
+const stagingHost = "packages-staging.couchbase.com"
+
+// checkURL enforces the HTTPS-only policy for download URLs: plain http
+// is refused unless the host is the staging host or in AllowHTTPHosts
+func (config *Config) checkURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("malformed URL '%s': %v", rawURL, err)
+	}
+	if parsed.Scheme != "http" || config.allowsHTTP(parsed.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("insecure URL %s: use https, or allow the host with --allow-http or allow_http_hosts", rawURL)
+}
+
+func (config *Config) allowsHTTP(host string) bool {
+	if strings.EqualFold(host, stagingHost) {
+		return true
+	}
+	for _, allowed := range config.AllowHTTPHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches plain-http URLs in a Dockerfile, stopping at quotes and
+// backslashes as well as whitespace
+var insecureURLPattern = regexp.MustCompile(`http://[^\s"'\\]+`)
+
+// insecureURL is a plain-http URL found in a committed Dockerfile
+type insecureURL struct {
+	// Relative to the base directory
+	File string
+	Line int
+	URL  string
+	// "insecure"; "allowed" if the host may use plain http; or
+	// "frozen" if the directory is excluded from generation, so the
+	// generator can't fix it
+	Status string
+}
+
+// auditURLs finds every plain-http URL in the Dockerfiles of the version
+// directories matched by the filter. Comments are ignored, as they aren't
+// downloaded.
+func (gen *Generator) auditURLs(filter variantFilter) ([]insecureURL, error) {
+	found := []insecureURL{}
+	for _, dir := range gen.allVersionDirs() {
+		if ok, err := filter.Matches(dir); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		dockerfile := path.Join(gen.BaseDir, string(dir.Edition), string(dir.Product), dir.Version, "Dockerfile")
+		file, err := os.Open(dockerfile)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		urls, err := findInsecureURLs(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dockerfile, err)
+		}
+
+		relative, err := filepath.Rel(gen.BaseDir, dockerfile)
+		if err != nil {
+			relative = dockerfile
+		}
+		for _, u := range urls {
+			u.File = relative
+			u.Status = "insecure"
+			if parsed, err := url.Parse(u.URL); err == nil && gen.Config.allowsHTTP(parsed.Hostname()) {
+				u.Status = "allowed"
+			} else if skipGeneration.Matches(dir.Product, dir.Version) {
+				u.Status = "frozen"
+			}
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+func findInsecureURLs(in io.Reader) ([]insecureURL, error) {
+	urls := []insecureURL{}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		for _, match := range insecureURLPattern.FindAllString(text, -1) {
+			urls = append(urls, insecureURL{Line: line, URL: match})
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// printAudit prints the URLs found by auditURLs, and returns how many of
+// them are insecure
+func printAudit(out io.Writer, urls []insecureURL) int {
+	insecure := 0
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "STATUS\tFILE\tURL")
+	for _, u := range urls {
+		fmt.Fprintf(table, "%s\t%s:%d\t%s\n", u.Status, u.File, u.Line, u.URL)
+		if u.Status == "insecure" {
+			insecure++
+		}
+	}
+	table.Flush()
+	return insecure
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of a product, as found in directory names, rules
+// and download URLs. It consists of any number of numeric sections (eg.
+// 8.0, 7.6.2 or 1.2.3.4), optionally followed by a suffix after a "-":
+//
+//   - a maintenance patch, eg. 7.0.3-MP1, which sorts after 7.0.3 and
+//     before 7.0.4
+//   - a build number, eg. 1.3.0-274, which sorts before 1.3.0 as it is a
+//     build leading up to that release
+//   - any other pre-release tag, eg. 7.0.0-beta or 1.2.0-rc1, which also
+//     sorts before the release
+//
+// Missing sections count as zero, so 8.0 and 8.0.0 are equal.
+type Version struct {
+	original string
+	sections []int64
+	kind     versionKind
+	// eg. "beta" or "274"; empty for releases
+	prerelease string
+	// The number of a maintenance patch, or the build number
+	number int64
+}
+
+type versionKind int
+
+// In order of precedence of versions with the same sections
+const (
+	versionPrerelease versionKind = iota
+	versionBuild
+	versionRelease
+	versionMP
+)
+
+var (
+	versionPattern      = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)(?:-([0-9A-Za-z_.-]+))?$`)
+	mpPattern           = regexp.MustCompile(`^MP([0-9]+)$`)
+	buildNumberPattern  = regexp.MustCompile(`^[0-9]+$`)
+	constraintOperators = []string{"~>", ">=", "<=", "!=", ">", "<", "="}
+)
+
+// parseVersion parses a version such as 7.6.2, 7.0.3-MP1 or 1.3.0-274
+func parseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, fmt.Errorf("malformed version '%s'", s)
+	}
+
+	v := Version{original: s, kind: versionRelease}
+	for _, section := range strings.Split(match[1], ".") {
+		n, err := strconv.ParseInt(section, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("malformed version '%s': section %s is too large", s, section)
+		}
+		v.sections = append(v.sections, n)
+	}
+
+	suffix := match[2]
+	if m := mpPattern.FindStringSubmatch(suffix); m != nil {
+		v.kind = versionMP
+		v.number, _ = strconv.ParseInt(m[1], 10, 64)
+	} else if buildNumberPattern.MatchString(suffix) {
+		number, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("malformed version '%s': build number is too large", s)
+		}
+		v.kind = versionBuild
+		v.prerelease = suffix
+		v.number = number
+	} else if suffix != "" {
+		v.kind = versionPrerelease
+		v.prerelease = suffix
+	}
+
+	return v, nil
+}
+
+// mustParseVersion parses a version known to be valid, for constants
+func mustParseVersion(s string) Version {
+	v, err := parseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (v Version) String() string {
+	return v.original
+}
+
+// Core returns the version without any suffix, eg. 7.0.0 for 7.0.0-beta
+func (v Version) Core() Version {
+	sections := []string{}
+	for _, section := range v.sections {
+		sections = append(sections, strconv.FormatInt(section, 10))
+	}
+	return Version{
+		original: strings.Join(sections, "."),
+		sections: v.sections,
+		kind:     versionRelease,
+	}
+}
+
+// IsPrerelease returns true for pre-release versions, including builds
+// leading up to a release
+func (v Version) IsPrerelease() bool {
+	return v.kind == versionPrerelease || v.kind == versionBuild
+}
+
+// Build returns the build number of a version such as 8.1.0-1234
+func (v Version) Build() (int64, bool) {
+	if v.kind != versionBuild {
+		return 0, false
+	}
+	return v.number, true
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than
+// other
+func (v Version) Compare(other Version) int {
+	if c := compareSections(v.sections, other.sections); c != 0 {
+		return c
+	}
+
+	rank := func(kind versionKind) versionKind {
+		// Builds and other pre-releases sort among themselves by their
+		// tags, with numeric tags first
+		if kind == versionBuild {
+			return versionPrerelease
+		}
+		return kind
+	}
+	if c := compareInts(int64(rank(v.kind)), int64(rank(other.kind))); c != 0 {
+		return c
+	}
+
+	switch rank(v.kind) {
+	case versionPrerelease:
+		return comparePrerelease(v.prerelease, other.prerelease)
+	case versionMP:
+		return compareInts(v.number, other.number)
+	}
+	return 0
+}
+
+func compareSections(a []int64, b []int64) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := compareInts(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// comparePrerelease compares pre-release tags as semver does: identifiers
+// separated by "." are compared in turn, numerically if both are numbers
+// and lexically otherwise, with numbers sorting first
+func comparePrerelease(a string, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, xErr := strconv.ParseInt(as[i], 10, 64)
+		y, yErr := strconv.ParseInt(bs[i], 10, 64)
+		switch {
+		case xErr == nil && yErr == nil:
+			if c := compareInts(x, y); c != 0 {
+				return c
+			}
+		case xErr == nil:
+			return -1
+		case yErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(int64(len(as)), int64(len(bs)))
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Constraints is a comma-separated list of version constraints which must
+// all be met, eg. ">= 7.1.0, < 8.0", "= 7.0.3", "!= 7.2.1" or "~> 7.6.0".
+// A pre-release version only meets constraints which name a pre-release
+// of the same version.
+type Constraints []constraint
+
+type constraint struct {
+	operator string
+	version  Version
+}
+
+// parseConstraints parses a list of constraints such as ">= 7.1.0, < 8.0"
+func parseConstraints(s string) (Constraints, error) {
+	constraints := Constraints{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty constraint")
+		}
+
+		operator := "="
+		for _, op := range constraintOperators {
+			if strings.HasPrefix(part, op) {
+				operator = op
+				part = strings.TrimSpace(strings.TrimPrefix(part, op))
+				break
+			}
+		}
+
+		v, err := parseVersion(part)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, constraint{operator, v})
+	}
+	return constraints, nil
+}
+
+// Check returns true if the version meets every constraint
+func (constraints Constraints) Check(v Version) bool {
+	for _, c := range constraints {
+		if !c.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c constraint) check(v Version) bool {
+	if v.IsPrerelease() {
+		if !c.version.IsPrerelease() || compareSections(v.sections, c.version.sections) != 0 {
+			return false
+		}
+	}
+
+	cmp := v.Compare(c.version)
+	switch c.operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		// eg. ~> 7.6.0 means >= 7.6.0, < 7.7.0, and ~> 7.6 means
+		// >= 7.6, < 8.0
+		if cmp < 0 {
+			return false
+		}
+		prefix := len(c.version.sections) - 1
+		if prefix < 1 {
+			return true
+		}
+		sections := make([]int64, prefix)
+		copy(sections, v.sections)
+		return compareSections(sections, c.version.sections[:prefix]) == 0
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version      string
+		core         string
+		isPrerelease bool
+		build        int64
+		isBuild      bool
+	}{
+		{version: "8.0", core: "8.0"},
+		{version: "7.6.2", core: "7.6.2"},
+		{version: "1.2.3.4", core: "1.2.3.4"},
+		{version: "7.100.0", core: "7.100.0"},
+		{version: "7.0.3-MP1", core: "7.0.3"},
+		{version: "1.3.0-274", core: "1.3.0", isPrerelease: true, build: 274, isBuild: true},
+		{version: "7.0.0-beta", core: "7.0.0", isPrerelease: true},
+		{version: "1.2.0-rc.1", core: "1.2.0", isPrerelease: true},
+	}
+
+	for _, test := range tests {
+		v, err := parseVersion(test.version)
+		if err != nil {
+			t.Errorf("%s: %v", test.version, err)
+			continue
+		}
+		if v.String() != test.version {
+			t.Errorf("%s: String() = %s", test.version, v)
+		}
+		if v.Core().String() != test.core {
+			t.Errorf("%s: Core() = %s, want %s", test.version, v.Core(), test.core)
+		}
+		if v.IsPrerelease() != test.isPrerelease {
+			t.Errorf("%s: IsPrerelease() = %t", test.version, v.IsPrerelease())
+		}
+		if build, ok := v.Build(); ok != test.isBuild || build != test.build {
+			t.Errorf("%s: Build() = %d, %t, want %d, %t", test.version, build, ok, test.build, test.isBuild)
+		}
+	}
+}
+
+func TestParseVersionErrors(t *testing.T) {
+	for _, version := range []string{
+		"", "v7.0", "7.", ".7", "7..0", "7.0-", "7.0.x", "latest",
+		"99999999999999999999.0", "1.0-99999999999999999999",
+	} {
+		if v, err := parseVersion(version); err == nil {
+			t.Errorf("%q: expected an error, got %s", version, v)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	// In ascending order; versions on the same line are equal
+	ordered := [][]string{
+		{"1.3.0-274"},
+		{"1.3.0-1000"},
+		{"1.3.0-beta"},
+		{"1.3.0", "1.3"},
+		{"6.6.5"},
+		{"7.0.0-5017"},
+		{"7.0.0-beta"},
+		{"7.0.0", "7", "7.0.0.0"},
+		{"7.0.3"},
+		{"7.0.3-MP1"},
+		{"7.0.3-MP2"},
+		{"7.0.3-MP10"},
+		{"7.0.4"},
+		{"7.2.9"},
+		{"7.10.0"},
+		{"7.100.0"},
+		{"8.0"},
+		{"100.0.0"},
+	}
+
+	for i, group := range ordered {
+		for _, a := range group {
+			va := mustParseVersion(a)
+			for j, other := range ordered {
+				for _, b := range other {
+					want := compareInts(int64(i), int64(j))
+					if got := va.Compare(mustParseVersion(b)); got != want {
+						t.Errorf("%s vs %s: got %d, want %d", a, b, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		constraints string
+		matching    []string
+		others      []string
+	}{
+		{"7.0.3", []string{"7.0.3", "7.0.3.0"}, []string{"7.0.4", "7.0.3-MP1"}},
+		{"= 7.0.3-MP1", []string{"7.0.3-MP1"}, []string{"7.0.3"}},
+		{"!= 7.2.1", []string{"7.2.0", "7.2.2"}, []string{"7.2.1"}},
+		{">= 7.1.0, < 8.0", []string{"7.1.0", "7.6.2", "7.100.0"}, []string{"7.0.5", "8.0.0", "8.0.1"}},
+		{"> 7.0.3", []string{"7.0.3-MP1", "7.0.4"}, []string{"7.0.3"}},
+		{"<= 7.0.3", []string{"7.0.3", "6.6.0"}, []string{"7.0.3-MP1"}},
+		{"~> 7.6.0", []string{"7.6.0", "7.6.11"}, []string{"7.5.9", "7.7.0", "8.0.0"}},
+		{"~> 7.6", []string{"7.6.0", "7.9.1"}, []string{"7.5.0", "8.0"}},
+		{"~> 7", []string{"7.0.0", "8.0.0", "100.0"}, []string{"6.6.5"}},
+		{"~> 1.2.3.4", []string{"1.2.3.4", "1.2.3.9"}, []string{"1.2.4.0"}},
+		// Pre-releases only match constraints naming a pre-release of the
+		// same version
+		{">= 7.0", []string{"7.0.0"}, []string{"7.0.0-beta", "7.1.0-5017"}},
+		{">= 7.0.0-beta", []string{"7.0.0-beta", "7.0.0-rc1", "7.0.0"}, []string{"7.0.1-beta", "7.0.0-5017"}},
+		{"= 1.3.0-274", []string{"1.3.0-274"}, []string{"1.3.0-275", "1.3.0"}},
+	}
+
+	for _, test := range tests {
+		constraints, err := parseConstraints(test.constraints)
+		if err != nil {
+			t.Errorf("%s: %v", test.constraints, err)
+			continue
+		}
+		for _, v := range test.matching {
+			if !constraints.Check(mustParseVersion(v)) {
+				t.Errorf("%s should match %s", test.constraints, v)
+			}
+		}
+		for _, v := range test.others {
+			if constraints.Check(mustParseVersion(v)) {
+				t.Errorf("%s shouldn't match %s", test.constraints, v)
+			}
+		}
+	}
+}
+
+func TestParseConstraintsErrors(t *testing.T) {
+	for _, constraints := range []string{"", ">= 7.0,", ">=", "=> 7.0", ">= v7.0", "7.0 < 8.0"} {
+		if _, err := parseConstraints(constraints); err == nil {
+			t.Errorf("%q: expected an error", constraints)
+		}
+	}
+}